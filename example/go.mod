@@ -8,3 +8,5 @@ require (
 	golang.org/x/exp v0.0.0-20241210194714-1829a127f884 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 )
+
+replace github.com/brycensranch/go-aptabase/pkg => ../pkg
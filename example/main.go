@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
 	"log"
+	"log/slog"
 )
 
 type Event struct {
@@ -20,7 +21,19 @@ func main() {
 	// host := "https://aptabase.brycen.app"
 	// A empty string uses automatic detection
 	host := ""
-	client := aptabase.NewClient(apiKey, appVersion, appBuildNumber, debugMode, host)
+	client, err := aptabase.New(apiKey,
+		aptabase.WithAppVersion(appVersion),
+		aptabase.WithAppBuildNumber(appBuildNumber),
+		aptabase.WithDebugMode(debugMode),
+		aptabase.WithHost(host),
+		// The SDK is silent unless you give it a logger.
+		aptabase.WithLogger(slog.Default()),
+		// Masks the emails below, along with other personal data, before anything leaves the process.
+		aptabase.WithRedactor(aptabase.NewRedactor(nil, aptabase.DefaultRedactionRules()...)),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create the Aptabase client: %v", err)
+	}
 	event := aptabase.EventData{
 		EventName: "UserSignUp",
 		Props: map[string]interface{}{
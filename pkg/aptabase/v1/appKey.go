@@ -0,0 +1,100 @@
+package aptabase
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RegionSelfHosted is the region code used by App Keys of self-hosted Aptabase instances.
+const RegionSelfHosted = "SH"
+
+var (
+	hostsMu sync.RWMutex
+	hosts   = map[string]string{
+		"EU":             "https://eu.aptabase.com",
+		"US":             "https://us.aptabase.com",
+		RegionSelfHosted: "",
+		"DEV":            "http://localhost:3000",
+	}
+)
+
+// AppKey is a parsed Aptabase App Key such as "A-EU-1234567890".
+type AppKey struct {
+	Prefix string // Always "A"
+	Region string // Region code, e.g. "EU", "US" or "SH"
+	ID     string // Numeric application identifier
+}
+
+// ParseAppKey parses and validates an App Key in the form "A-<REGION>-<ID>".
+// Errors wrap ErrInvalidAppKey.
+func ParseAppKey(s string) (AppKey, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return AppKey{}, fmt.Errorf("%w: expected 3 dash-separated parts, got %d", ErrInvalidAppKey, len(parts))
+	}
+	key := AppKey{Prefix: parts[0], Region: parts[1], ID: parts[2]}
+	if key.Prefix != "A" {
+		return AppKey{}, fmt.Errorf("%w: prefix must be %q, got %q", ErrInvalidAppKey, "A", key.Prefix)
+	}
+	if !isRegionCode(key.Region) {
+		return AppKey{}, fmt.Errorf("%w: malformed region %q", ErrInvalidAppKey, key.Region)
+	}
+	if key.ID == "" || strings.Trim(key.ID, "0123456789") != "" {
+		return AppKey{}, fmt.Errorf("%w: id must be numeric, got %q", ErrInvalidAppKey, key.ID)
+	}
+	return key, nil
+}
+
+// String returns the App Key in its original "A-<REGION>-<ID>" form.
+func (k AppKey) String() string {
+	return k.Prefix + "-" + k.Region + "-" + k.ID
+}
+
+// IsSelfHosted reports whether the key belongs to a self-hosted Aptabase instance.
+func (k AppKey) IsSelfHosted() bool {
+	return k.Region == RegionSelfHosted
+}
+
+// Host returns the base URL registered for the key's region.
+// Self-hosted keys return an empty host unless RegisterRegion overrode "SH".
+func (k AppKey) Host() (string, error) {
+	hostsMu.RLock()
+	defer hostsMu.RUnlock()
+	host, exists := hosts[k.Region]
+	if !exists {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRegion, k.Region)
+	}
+	return host, nil
+}
+
+// RegisterRegion adds a region code or overrides the host of an existing one, such as "DEV".
+// It is safe to call concurrently, but only affects clients created afterwards.
+func RegisterRegion(code, baseURL string) error {
+	if !isRegionCode(code) {
+		return fmt.Errorf("%w: malformed region code %q", ErrInvalidOption, code)
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: region %s needs an absolute http(s) URL, got %q", ErrInvalidOption, code, baseURL)
+	}
+
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	hosts[code] = strings.TrimSuffix(baseURL, "/")
+	return nil
+}
+
+// isRegionCode reports whether s is a non-empty run of uppercase letters and digits.
+func isRegionCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,97 +1,210 @@
 package aptabase
 
 import (
+	"errors"
 	"fmt"
 	"golang.org/x/exp/rand"
-	"strings"
 	"time"
 )
 
-var hosts = map[string]string{
-	"EU":  "https://eu.aptabase.com",
-	"US":  "https://us.aptabase.com",
-	"SH":  "",
-	"DEV": "http://localhost:3000",
-}
-
 // EventData represents the structure of the event data passed to TrackEvent.
 type EventData struct {
 	EventName   string                 `json:"eventName"`
 	Props       map[string]interface{} `json:"props"`
-	Timestamp   string                 `json:"Timestamp"`
-	SessionId   string                 `json:"SessionId"`
+	Timestamp   time.Time              `json:"Timestamp"` // When the event happened, TrackEvent uses the current time if zero
+	SessionId   string                 `json:"SessionId"` // Session the event belongs to, TrackEvent uses the current session if empty
 	SystemProps map[string]interface{} `json:"SystemProps"`
 }
 
-// determineHost selects the host URL based on the AppKey.
-func (c *Client) determineHost(apiKey string) string {
-	parts := strings.Split(apiKey, "-")
-	if len(parts) < 2 {
-		 panic("Invalid API Key format")
-	}
-
-	regionCode := parts[1] // The second part should be the region code (e.g., "US" from "A-US-0343858461")
-
-	host, exists := hosts[regionCode]
-	if !exists {
-		panic("Host not found for region " + regionCode)
-	}
-
-	return host
-}
-
 // NewSessionID generates a new session ID in the format of epochInSeconds + 8 random numbers.
 func (c *Client) NewSessionID() string {
+	return newSessionIDAt(time.Now())
+}
+
+// newSessionIDAt generates a session ID for a session that started at t.
+func newSessionIDAt(t time.Time) string {
 	rand.Seed(uint64(time.Now().UnixNano()))
-	epochSeconds := time.Now().UTC().Unix()
+	epochSeconds := t.UTC().Unix()
 	randomNumber := rand.Intn(100000000)
 	return fmt.Sprintf("%d%08d", epochSeconds, randomNumber)
 }
 
 // EvalSessionID evaluates and updates the session ID if the session has expired.
+// It is safe to call concurrently; read SessionID and LastTouch through it rather than directly.
 func (c *Client) EvalSessionID() string {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
 	now := time.Now().UTC()
-	if now.Sub(c.LastTouch) > c.SessionTimeout {
+	expired := now.Sub(c.LastTouch) > c.SessionTimeout
+	if expired {
 		c.SessionID = c.NewSessionID()
 	}
 	c.LastTouch = now
+	if c.sessionStore != nil && (c.SessionID != c.sessionSavedID || now.Sub(c.sessionSaved) >= sessionSaveInterval) {
+		// The store locks and syncs a file, which processQueue does off the caller's goroutine
+		select {
+		case c.sessionDue <- struct{}{}:
+		default:
+		}
+	}
 	return c.SessionID
 }
 
 // Stop gracefully stops the event processing and sends any remaining events.
+// Events still unsent after the stop timeout are kept in the disk queue, if one is configured.
+// Calling Stop more than once is a no-op.
 func (c *Client) Stop() {
-	c.Logger.Println("Stop called")
+	c.stopOnce.Do(c.stop)
+}
+
+func (c *Client) stop() {
+	c.Logger.Debug("Stop called")
+	c.stopping.Store(true)
 	c.Quit = true
-	c.quitChan <- struct{}{}
 	close(c.quitChan)
-	if (c.DebugMode) { c.Logger.Printf("Starting to wait for goroutines to finish.") }
+	c.Logger.Debug("Waiting for pending sends to finish", "timeout", c.stopTimeout)
 
-	timeout := time.After(5 * time.Second)
+	timeout := time.After(c.stopTimeout)
 
 	// Use select to either wait for all goroutines to finish or a timeout
 	done := make(chan struct{})
 
 	go func() {
+		<-c.stopped // processQueue has handed its last batch over to sendBatch
 		// Wait for all goroutines to finish
 		c.wg.Wait()
-		if (finishedFlushing) {
-			done <- struct{}{} // Signal that all goroutines are finished
-		} 
+		close(done) // Signal that all goroutines are finished
 	}()
 
 	select {
 	case <-done:
-		if (c.DebugMode) { c.Logger.Printf("Finished waiting!") }
+		c.Logger.Debug("Finished waiting for pending sends")
 	case <-timeout:
 		// Timeout occurred
-		if (c.DebugMode) { c.Logger.Println("Timeout reached before all goroutines finished.") }
+		c.Logger.Warn("Stop timed out before all events were sent", "timeout", c.stopTimeout)
+		c.cancel() // Also frees processQueue if it waits for a request slot
+		<-c.stopped
+	}
+	c.discardQueued()
+	c.cancel() // Abort requests and retries still in flight
+
+	c.saveSession(true)
+
+	if c.diskQueue != nil {
+		if err := c.diskQueue.Close(); err != nil {
+			c.Logger.Error("Error closing the disk queue", "error", err)
+		}
 	}
 }
 
 // TrackEvent queues an event with the specified EventData for tracking.
-func (c *Client) TrackEvent(event EventData) {
-	if c.DebugMode {
-		c.Logger.Printf("TrackEvent called with event: %+v", event)
+// Events left out by sampling, rate limits, for lack of consent or because the environment opts out
+// of telemetry are discarded without an error, see WithSampleRate, WithRateLimit, WithConsent and Disabled.
+// Props are checked according to the client's PropsMode, invalid ones are reported as a *PropError.
+// If the queue is full it follows the client's OverflowPolicy, which may return ErrQueueFull.
+func (c *Client) TrackEvent(event EventData) error {
+	c.Logger.Debug("TrackEvent called", "eventName", event.EventName)
+	if c.stopping.Load() {
+		c.Logger.Warn("TrackEvent called after Stop, dropping event", "eventName", event.EventName)
+		c.stats.recordDropped(1, false)
+		return ErrClientStopped
+	}
+	if c.disabledReason != "" {
+		return nil
+	}
+	if c.consentBlocks() {
+		c.stats.recordDropped(1, false)
+		return nil
+	}
+	err := c.prepareEvent(&event)
+	if c.skipped(err) {
+		return nil
+	}
+	if err == nil && c.holdForConsent(event) {
+		return nil
+	}
+	if err == nil {
+		err = c.enqueue(event)
+	}
+	if err != nil {
+		c.stats.recordDropped(1, false)
+	}
+	return err
+}
+
+// Track queues an event with the given name and props, see TrackEvent.
+func (c *Client) Track(name string, props Props) error {
+	return c.TrackEvent(EventData{EventName: name, Props: props})
+}
+
+// TryTrackEvent queues an event without ever blocking, regardless of the OverflowPolicy.
+// It reports whether the event was accepted.
+func (c *Client) TryTrackEvent(event EventData) bool {
+	if c.stopping.Load() {
+		c.stats.recordDropped(1, false)
+		return false
+	}
+	if c.disabledReason != "" {
+		return true
+	}
+	if c.consentBlocks() {
+		c.stats.recordDropped(1, false)
+		return true
+	}
+	err := c.prepareEvent(&event)
+	if c.skipped(err) {
+		return true
+	}
+	if err != nil {
+		c.Logger.Warn("Dropping event with invalid props", "eventName", event.EventName, "error", err)
+		c.stats.recordDropped(1, false)
+		return false
+	}
+	if c.holdForConsent(event) {
+		return true
+	}
+	select {
+	case c.eventChan <- event:
+		c.queued()
+		return true
+	default:
+		c.stats.recordDropped(1, false)
+		return false
+	}
+}
+
+// prepareEvent fills in the timestamp and session of an event being tracked, samples and rate limits it,
+// then checks and redacts its props. It returns errSampledOut or errRateLimited for events left out.
+func (c *Client) prepareEvent(event *EventData) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.SessionId == "" {
+		event.SessionId = c.EvalSessionID()
+	}
+	if !c.sample(event) {
+		return errSampledOut
+	}
+	// Events limited before the user consented are not reported in the summary.
+	if c.rateLimiter != nil && !c.rateLimiter.allow(event, time.Now(), c.Consent() == ConsentGranted) {
+		return errRateLimited
+	}
+	if err := c.normalizeProps(event); err != nil {
+		return err
+	}
+	c.redactProps(event)
+	return nil
+}
+
+// skipped counts events prepareEvent left out on purpose, which TrackEvent does not report as errors.
+func (c *Client) skipped(err error) bool {
+	switch {
+	case errors.Is(err, errSampledOut):
+		c.stats.sampled.Add(1)
+	case errors.Is(err, errRateLimited):
+		c.stats.rateLimited.Add(1)
+	default:
+		return false
 	}
-	c.eventChan <- event
+	return true
 }
@@ -0,0 +1,326 @@
+// Package aptabasetest provides an in-process fake of the Aptabase ingestion API for testing instrumentation.
+//
+// A Server accepts batches on /api/v0/events, validates them like the real service and records the events,
+// so tests can assert on what an application tracked without reaching eu/us.aptabase.com:
+//
+//	srv := aptabasetest.NewServer("A-US-1234567890")
+//	defer srv.Close()
+//	client := srv.NewClient(t)
+//	client.TrackEvent(aptabase.EventData{EventName: "app_started"})
+//	srv.WaitForEvent(t, "app_started")
+package aptabasetest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+)
+
+// MaxBatchSize is the number of events Aptabase accepts in a single request.
+const MaxBatchSize = aptabase.MaxEventsPerRequest
+
+// DefaultTimeout is how long the Wait helpers wait unless Server.Timeout is set.
+const DefaultTimeout = 5 * time.Second
+
+// response is a canned reply used instead of accepting a request.
+type response struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+// Server is a fake Aptabase server backed by an httptest.Server.
+type Server struct {
+	*httptest.Server
+	AppKey  string
+	Timeout time.Duration // Used by the Wait helpers, defaults to DefaultTimeout
+
+	mu       sync.Mutex
+	events   []aptabase.Event
+	requests int
+	rejected int
+	latency  time.Duration
+	canned   []response
+	changed  chan struct{} // Closed and replaced whenever events are recorded
+}
+
+// NewServer starts a fake server that accepts events for appKey.
+func NewServer(appKey string) *Server {
+	s := &Server{
+		AppKey:  appKey,
+		Timeout: DefaultTimeout,
+		changed: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/events", s.handleEvents)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// ClientOptions returns the options that point a client at the server.
+func (s *Server) ClientOptions() []aptabase.Option {
+	return []aptabase.Option{aptabase.WithHost(s.URL)}
+}
+
+// NewClient creates a client for the server's App Key and stops it when the test finishes.
+func (s *Server) NewClient(t testing.TB, opts ...aptabase.Option) *aptabase.Client {
+	t.Helper()
+	client, err := aptabase.New(s.AppKey, append(s.ClientOptions(), opts...)...)
+	if err != nil {
+		t.Fatalf("aptabasetest: creating client: %v", err)
+	}
+	t.Cleanup(client.Stop)
+	return client
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext answers the next n requests with statusCode without recording their events.
+func (s *Server) FailNext(n int, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.canned = append(s.canned, response{statusCode: statusCode})
+	}
+}
+
+// RateLimitNext answers the next n requests with 429 Too Many Requests and the given Retry-After.
+func (s *Server) RateLimitNext(n int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.canned = append(s.canned, response{statusCode: http.StatusTooManyRequests, retryAfter: retryAfter})
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	latency := s.latency
+	var canned *response
+	if len(s.canned) > 0 {
+		canned = &s.canned[0]
+		s.canned = s.canned[1:]
+	}
+	s.mu.Unlock()
+
+	// Read the body up front, net/http only notices a client that gave up once it is read.
+	raw, readErr := io.ReadAll(r.Body)
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if canned != nil {
+		if canned.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((canned.retryAfter+time.Second-1)/time.Second)))
+		}
+		s.reject(w, canned.statusCode, "%s", http.StatusText(canned.statusCode))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		s.reject(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	appKey := r.Header.Get("App-Key")
+	if appKey == "" {
+		s.reject(w, http.StatusBadRequest, "missing App-Key header")
+		return
+	}
+	if appKey != s.AppKey {
+		s.reject(w, http.StatusUnauthorized, "unknown App-Key %q", appKey)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		s.reject(w, http.StatusUnsupportedMediaType, "unsupported Content-Type %q", contentType)
+		return
+	}
+
+	if readErr != nil {
+		s.reject(w, http.StatusBadRequest, "reading body: %v", readErr)
+		return
+	}
+	var reader io.Reader = bytes.NewReader(raw)
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			s.reject(w, http.StatusBadRequest, "reading gzip body: %v", err)
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	default:
+		s.reject(w, http.StatusUnsupportedMediaType, "unsupported Content-Encoding %q", encoding)
+		return
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, "reading body: %v", err)
+		return
+	}
+	events, err := decodeBatch(body)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, events...)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) reject(w http.ResponseWriter, statusCode int, format string, args ...interface{}) {
+	s.mu.Lock()
+	s.rejected++
+	s.mu.Unlock()
+	http.Error(w, fmt.Sprintf(format, args...), statusCode)
+}
+
+// Events returns a copy of every event accepted so far, in arrival order.
+func (s *Server) Events() []aptabase.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]aptabase.Event(nil), s.events...)
+}
+
+// EventsNamed returns the accepted events with the given name.
+func (s *Server) EventsNamed(name string) []aptabase.Event {
+	var named []aptabase.Event
+	for _, event := range s.Events() {
+		if event.EventName == name {
+			named = append(named, event)
+		}
+	}
+	return named
+}
+
+// Requests returns how many requests the server received, including rejected ones.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Rejected returns how many requests were answered with an error status.
+func (s *Server) Rejected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rejected
+}
+
+// Reset forgets recorded events, counters, canned failures and latency.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+	s.requests = 0
+	s.rejected = 0
+	s.latency = 0
+	s.canned = nil
+}
+
+// WaitForEvent waits until an event with the given name is accepted and returns the first one.
+// It fails the test if none arrives within the server's Timeout.
+func (s *Server) WaitForEvent(t testing.TB, name string) aptabase.Event {
+	t.Helper()
+	var found aptabase.Event
+	ok := s.wait(func(events []aptabase.Event) bool {
+		for _, event := range events {
+			if event.EventName == name {
+				found = event
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		t.Fatalf("aptabasetest: event %q not received within %s, got %s", name, s.Timeout, eventNames(s.Events()))
+	}
+	return found
+}
+
+// WaitForEvents waits until at least n events are accepted and returns all of them.
+// It fails the test if they do not arrive within the server's Timeout.
+func (s *Server) WaitForEvents(t testing.TB, n int) []aptabase.Event {
+	t.Helper()
+	if !s.wait(func(events []aptabase.Event) bool { return len(events) >= n }) {
+		t.Fatalf("aptabasetest: expected %d events within %s, got %d", n, s.Timeout, len(s.Events()))
+	}
+	return s.Events()
+}
+
+// AssertNoEvent fails the test if an event with the given name was accepted.
+func (s *Server) AssertNoEvent(t testing.TB, name string) {
+	t.Helper()
+	if n := len(s.EventsNamed(name)); n > 0 {
+		t.Errorf("aptabasetest: expected no %q event, got %d", name, n)
+	}
+}
+
+// AssertProp fails the test if the event does not have the prop key set to want.
+// Numbers are compared as float64 since that is how they are decoded from JSON.
+func AssertProp(t testing.TB, event aptabase.Event, key string, want interface{}) {
+	t.Helper()
+	got, ok := event.Props[key]
+	if !ok {
+		t.Errorf("aptabasetest: event %q has no prop %q", event.EventName, key)
+		return
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("aptabasetest: event %q prop %q = %v, want %v", event.EventName, key, got, want)
+	}
+}
+
+// wait blocks until done reports true for the accepted events or the timeout expires.
+func (s *Server) wait(done func([]aptabase.Event) bool) bool {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		events := s.events
+		changed := s.changed
+		s.mu.Unlock()
+		if done(events) {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+func eventNames(events []aptabase.Event) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.EventName
+	}
+	return names
+}
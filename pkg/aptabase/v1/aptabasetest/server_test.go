@@ -0,0 +1,312 @@
+package aptabasetest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1/aptabasetest"
+)
+
+const appKey = "A-US-1234567890"
+
+const systemProps = `{"osName":"Linux","osVersion":"6.1","locale":"en-US","appVersion":"1.0.0","sdkVersion":"aptabase-go@test","isDebug":false}`
+
+// event returns the JSON of a valid event with the given JSON props, {} if props is empty.
+func event(name, props string) string {
+	if props == "" {
+		props = "{}"
+	}
+	return fmt.Sprintf(`{"timestamp":"2024-05-01T10:00:00.000Z","sessionId":"171455040012345678","eventName":%q,"systemProps":%s,"props":%s}`,
+		name, systemProps, props)
+}
+
+type request struct {
+	method      string
+	appKey      string
+	contentType string
+	encoding    string
+	body        []byte
+}
+
+func validRequest(body string) request {
+	return request{method: http.MethodPost, appKey: appKey, contentType: "application/json", body: []byte(body)}
+}
+
+func (r request) send(t *testing.T, srv *aptabasetest.Server) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(r.method, srv.URL+"/api/v0/events", bytes.NewReader(r.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.appKey != "" {
+		req.Header.Set("App-Key", r.appKey)
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if r.encoding != "" {
+		req.Header.Set("Content-Encoding", r.encoding)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServerValidation(t *testing.T) {
+	tooMany := make([]string, aptabasetest.MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = event("e", "")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*request)
+		want   int
+	}{
+		{"valid", func(*request) {}, http.StatusOK},
+		{"valid props", func(r *request) { r.body = []byte("[" + event("e", `{"s":"x","n":1.5,"b":true}`) + "]") }, http.StatusOK},
+		{"full batch", func(r *request) { r.body = []byte("[" + strings.Join(tooMany[1:], ",") + "]") }, http.StatusOK},
+		{"wrong method", func(r *request) { r.method = http.MethodPut }, http.StatusMethodNotAllowed},
+		{"missing app key", func(r *request) { r.appKey = "" }, http.StatusBadRequest},
+		{"unknown app key", func(r *request) { r.appKey = "A-EU-1234567890" }, http.StatusUnauthorized},
+		{"wrong content type", func(r *request) { r.contentType = "text/plain" }, http.StatusUnsupportedMediaType},
+		{"unknown encoding", func(r *request) { r.encoding = "br" }, http.StatusUnsupportedMediaType},
+		{"not json", func(r *request) { r.body = []byte("nope") }, http.StatusBadRequest},
+		{"object instead of array", func(r *request) { r.body = []byte(event("e", "")) }, http.StatusBadRequest},
+		{"empty batch", func(r *request) { r.body = []byte("[]") }, http.StatusBadRequest},
+		{"batch too large", func(r *request) { r.body = []byte("[" + strings.Join(tooMany, ",") + "]") }, http.StatusBadRequest},
+		{"missing event name", func(r *request) { r.body = []byte(strings.Replace(string(r.body), `"eventName":"e",`, "", 1)) }, http.StatusBadRequest},
+		{"missing session", func(r *request) {
+			r.body = []byte(strings.Replace(string(r.body), `"sessionId":"171455040012345678",`, "", 1))
+		}, http.StatusBadRequest},
+		{"bad timestamp", func(r *request) {
+			r.body = []byte(strings.Replace(string(r.body), "2024-05-01T10:00:00.000Z", "yesterday", 1))
+		}, http.StatusBadRequest},
+		{"missing system prop", func(r *request) { r.body = []byte(strings.Replace(string(r.body), `"locale":"en-US",`, "", 1)) }, http.StatusBadRequest},
+		{"nested prop", func(r *request) { r.body = []byte("[" + event("e", `{"nested":{"a":1}}`) + "]") }, http.StatusBadRequest},
+		{"null prop", func(r *request) { r.body = []byte("[" + event("e", `{"none":null}`) + "]") }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := aptabasetest.NewServer(appKey)
+			defer srv.Close()
+			req := validRequest("[" + event("e", "") + "]")
+			tt.modify(&req)
+
+			resp := req.send(t, srv)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			accepted := tt.want == http.StatusOK
+			if got := len(srv.Events()) > 0; got != accepted {
+				t.Errorf("events recorded = %v, want %v", got, accepted)
+			}
+			if got, want := srv.Rejected(), map[bool]int{true: 0, false: 1}[accepted]; got != want {
+				t.Errorf("Rejected = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestServerProps(t *testing.T) {
+	srv := aptabasetest.NewServer(appKey)
+	defer srv.Close()
+	validRequest("["+event("e", `{"s":"x","n":2,"b":true}`)+"]").send(t, srv)
+
+	got := srv.WaitForEvent(t, "e")
+	aptabasetest.AssertProp(t, got, "s", "x")
+	aptabasetest.AssertProp(t, got, "n", 2)
+	aptabasetest.AssertProp(t, got, "b", true)
+	if got.SessionID != "171455040012345678" || got.SystemProps["osName"] != "Linux" {
+		t.Errorf("event = %+v", got)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC); !got.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %s, want %s", got.Timestamp, want)
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	srv := aptabasetest.NewServer(appKey)
+	defer srv.Close()
+	srv.FailNext(2, http.StatusServiceUnavailable)
+
+	req := validRequest("[" + event("e", "") + "]")
+	for i, want := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK} {
+		if resp := req.send(t, srv); resp.StatusCode != want {
+			t.Errorf("request %d: status = %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+	if got := srv.Requests(); got != 3 {
+		t.Errorf("Requests = %d, want 3", got)
+	}
+	if got := srv.Rejected(); got != 2 {
+		t.Errorf("Rejected = %d, want 2", got)
+	}
+	if got := len(srv.Events()); got != 1 {
+		t.Errorf("%d events recorded, want only the accepted one", got)
+	}
+
+	srv.FailNext(1, http.StatusBadRequest)
+	srv.Reset()
+	if resp := req.send(t, srv); resp.StatusCode != http.StatusOK {
+		t.Errorf("status after Reset = %d, want the canned failure forgotten", resp.StatusCode)
+	}
+	if got := srv.Requests(); got != 1 {
+		t.Errorf("Requests after Reset = %d, want 1", got)
+	}
+}
+
+func TestServerRateLimitNext(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{2 * time.Second, "2"},
+		{1500 * time.Millisecond, "2"},
+		{0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.retryAfter.String(), func(t *testing.T) {
+			srv := aptabasetest.NewServer(appKey)
+			defer srv.Close()
+			srv.RateLimitNext(1, tt.retryAfter)
+
+			req := validRequest("[" + event("e", "") + "]")
+			resp := req.send(t, srv)
+			if resp.StatusCode != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Retry-After"); got != tt.want {
+				t.Errorf("Retry-After = %q, want %q", got, tt.want)
+			}
+			if resp := req.send(t, srv); resp.StatusCode != http.StatusOK {
+				t.Errorf("status after the rate limit = %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServerGzip(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     func(t *testing.T) []byte
+		want     int
+	}{
+		{"gzip", "gzip", func(t *testing.T) []byte { return gzipped(t, "["+event("e", "")+"]") }, http.StatusOK},
+		{"identity", "identity", func(*testing.T) []byte { return []byte("[" + event("e", "") + "]") }, http.StatusOK},
+		{"not gzip", "gzip", func(*testing.T) []byte { return []byte("[" + event("e", "") + "]") }, http.StatusBadRequest},
+		{"truncated gzip", "gzip", func(t *testing.T) []byte {
+			body := gzipped(t, "["+event("e", "")+"]")
+			return body[:len(body)-8]
+		}, http.StatusBadRequest},
+		{"gzip invalid batch", "gzip", func(t *testing.T) []byte { return gzipped(t, "[]") }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := aptabasetest.NewServer(appKey)
+			defer srv.Close()
+			req := validRequest("")
+			req.encoding = tt.encoding
+			req.body = tt.body(t)
+			if resp := req.send(t, srv); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientDelivery(t *testing.T) {
+	srv := aptabasetest.NewServer(appKey)
+	defer srv.Close()
+	fast := aptabase.RetryPolicy{MaxAttempts: 5, InitialInterval: 10 * time.Millisecond, Multiplier: 1}
+
+	tests := []struct {
+		name  string
+		opts  []aptabase.Option
+		setup func()
+	}{
+		{"plain", nil, func() {}},
+		{"gzip", []aptabase.Option{aptabase.WithGzip(1)}, func() {}},
+		{"retried", []aptabase.Option{aptabase.WithRetryPolicy(fast)}, func() { srv.FailNext(2, http.StatusBadGateway) }},
+		{"rate limited", []aptabase.Option{aptabase.WithRetryPolicy(fast)}, func() { srv.RateLimitNext(1, time.Second) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.Reset()
+			tt.setup()
+			opts := append([]aptabase.Option{aptabase.WithFlushInterval(20 * time.Millisecond)}, tt.opts...)
+			client := srv.NewClient(t, opts...)
+
+			if err := client.Track("app_started", aptabase.Props{"plan": "pro", "seats": 3}); err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Track("app_closed", nil); err != nil {
+				t.Fatal(err)
+			}
+			events := srv.WaitForEvents(t, 2)
+			started := srv.WaitForEvent(t, "app_started")
+			aptabasetest.AssertProp(t, started, "plan", "pro")
+			aptabasetest.AssertProp(t, started, "seats", 3)
+			if events[0].SessionID == "" || events[0].SessionID != events[1].SessionID {
+				t.Errorf("events are not in one session: %q and %q", events[0].SessionID, events[1].SessionID)
+			}
+			client.Stop()
+			if stats := client.Stats(); stats.Sent != 2 || stats.Dropped != 0 {
+				t.Errorf("Stats = %+v, want 2 sent", stats)
+			}
+			srv.AssertNoEvent(t, aptabase.RateLimitedEvent)
+		})
+	}
+}
+
+func TestClientRateLimitSummary(t *testing.T) {
+	srv := aptabasetest.NewServer(appKey)
+	defer srv.Close()
+	client := srv.NewClient(t, aptabase.WithFlushInterval(20*time.Millisecond),
+		aptabase.WithRateLimit("clicked", aptabase.RateLimit{Rate: 0.001, Burst: 2}), aptabase.WithSessionQuota(4))
+
+	for i := 0; i < 5; i++ {
+		if err := client.Track("clicked", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := client.Track("scrolled", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary := srv.WaitForEvent(t, aptabase.RateLimitedEvent)
+	aptabasetest.AssertProp(t, summary, "total", 4)
+	aptabasetest.AssertProp(t, summary, "event.clicked", 3)
+	aptabasetest.AssertProp(t, summary, "event.scrolled", 1)
+	if got := len(srv.EventsNamed("clicked")) + len(srv.EventsNamed("scrolled")); got != 4 {
+		t.Errorf("%d events sent, want the 4 within the limits", got)
+	}
+	client.Stop()
+	if stats := client.Stats(); stats.Limited != 4 {
+		t.Errorf("Limited = %d, want 4", stats.Limited)
+	}
+}
@@ -0,0 +1,105 @@
+package aptabasetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+)
+
+// requiredSystemProps are the system props every Aptabase SDK reports.
+var requiredSystemProps = []string{"osName", "osVersion", "locale", "appVersion", "sdkVersion", "isDebug"}
+
+// wireEvent mirrors the JSON schema of /api/v0/events, with pointers to tell missing fields apart.
+type wireEvent struct {
+	Timestamp   *string                    `json:"timestamp"`
+	SessionID   *string                    `json:"sessionId"`
+	EventName   *string                    `json:"eventName"`
+	SystemProps map[string]interface{}     `json:"systemProps"`
+	Props       map[string]json.RawMessage `json:"props"`
+}
+
+// decodeBatch parses and validates a request body, returning the events it holds.
+func decodeBatch(body []byte) ([]aptabase.Event, error) {
+	var batch []wireEvent
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("body must be a JSON array of events: %v", err)
+	}
+	if len(batch) == 0 {
+		return nil, errors.New("batch must contain at least one event")
+	}
+	if len(batch) > MaxBatchSize {
+		return nil, fmt.Errorf("batch has %d events, the limit is %d", len(batch), MaxBatchSize)
+	}
+
+	events := make([]aptabase.Event, 0, len(batch))
+	for i, wire := range batch {
+		event, err := wire.validate()
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %v", i, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (w wireEvent) validate() (aptabase.Event, error) {
+	var event aptabase.Event
+	if w.EventName == nil || *w.EventName == "" {
+		return event, errors.New("eventName is required")
+	}
+	event.EventName = *w.EventName
+	if w.SessionID == nil || *w.SessionID == "" {
+		return event, errors.New("sessionId is required")
+	}
+	event.SessionID = *w.SessionID
+	if w.Timestamp == nil {
+		return event, errors.New("timestamp is required")
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, *w.Timestamp)
+	if err != nil {
+		return event, fmt.Errorf("timestamp %q is not ISO 8601: %v", *w.Timestamp, err)
+	}
+	event.Timestamp = timestamp
+
+	if w.SystemProps == nil {
+		return event, errors.New("systemProps is required")
+	}
+	for _, key := range requiredSystemProps {
+		if _, ok := w.SystemProps[key]; !ok {
+			return event, fmt.Errorf("systemProps.%s is required", key)
+		}
+	}
+	event.SystemProps = w.SystemProps
+
+	event.Props = make(map[string]interface{}, len(w.Props))
+	for key, raw := range w.Props {
+		value, err := decodeProp(raw)
+		if err != nil {
+			return event, fmt.Errorf("props.%s: %v", key, err)
+		}
+		event.Props[key] = value
+	}
+	return event, nil
+}
+
+// decodeProp accepts the prop types Aptabase stores: strings, numbers and booleans.
+func decodeProp(raw json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case string, bool:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return nil, fmt.Errorf("value must be a string, number or boolean, got %s", raw)
+	}
+}
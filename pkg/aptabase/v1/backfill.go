@@ -0,0 +1,59 @@
+package aptabase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrMissingTimestamp is returned by Backfill for events without a Timestamp.
+var ErrMissingTimestamp = errors.New("aptabase: backfilled events need a timestamp")
+
+// Backfill imports historical events with their original timestamps, bypassing the queue.
+// Events without a SessionId are grouped into sessions by time, using the client's session timeout.
+// It blocks until every batch is sent or ctx is done, and stops at the first batch that fails.
+// A client disabled by the environment discards the events, and ErrConsent is returned unless
+// the user granted consent.
+func (c *Client) Backfill(ctx context.Context, events []EventData) error {
+	if len(events) == 0 || c.disabledReason != "" {
+		return nil
+	}
+	if c.Consent() != ConsentGranted {
+		return ErrConsent
+	}
+	sorted := make([]EventData, len(events))
+	copy(sorted, events)
+	for i, event := range sorted {
+		if event.Timestamp.IsZero() {
+			return fmt.Errorf("%w: event %d (%s)", ErrMissingTimestamp, i, event.EventName)
+		}
+		if err := c.normalizeProps(&sorted[i]); err != nil {
+			return fmt.Errorf("event %d (%s): %w", i, event.EventName, err)
+		}
+		c.redactProps(&sorted[i])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	var sessionID string
+	lastTouch := sorted[0].Timestamp
+	for i := range sorted {
+		event := &sorted[i]
+		if event.SessionId != "" {
+			continue
+		}
+		if sessionID == "" || event.Timestamp.Sub(lastTouch) > c.SessionTimeout {
+			sessionID = newSessionIDAt(event.Timestamp)
+		}
+		lastTouch = event.Timestamp
+		event.SessionId = sessionID
+	}
+
+	for _, bounds := range c.requestBounds(sorted) {
+		if _, err := c.sendWithRetry(ctx, sorted[bounds[0]:bounds[1]]); err != nil {
+			return fmt.Errorf("aptabase: backfilling events %d to %d: %w", bounds[0], bounds[1]-1, err)
+		}
+	}
+	c.Logger.Info("Backfilled events", "events", len(sorted))
+	return nil
+}
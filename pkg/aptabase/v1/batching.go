@@ -0,0 +1,44 @@
+package aptabase
+
+import (
+	"encoding/json"
+)
+
+// MaxEventsPerRequest is the number of events Aptabase accepts in a single request.
+// Larger batches are split into several requests.
+const MaxEventsPerRequest = 25
+
+// eventOverhead approximates the bytes an event adds to a request on top of its name and props:
+// the JSON keys, timestamp, session ID and separators.
+const eventOverhead = 128
+
+// requestBounds splits events into consecutive [start, end) ranges that each fit in a single
+// request, respecting MaxEventsPerRequest, the client's batch size and its max payload bytes.
+// An event larger than the byte limit on its own gets a request to itself.
+func (c *Client) requestBounds(events []EventData) [][2]int {
+	maxEvents := min(c.batchSize, MaxEventsPerRequest)
+	var bounds [][2]int
+	start, size := 0, 2 // The enclosing brackets
+	for i, event := range events {
+		eventSize := c.estimateSize(event)
+		if i > start && (i-start >= maxEvents || size+eventSize > c.maxPayloadBytes) {
+			bounds = append(bounds, [2]int{start, i})
+			start, size = i, 2
+		}
+		size += eventSize
+	}
+	if start < len(events) {
+		bounds = append(bounds, [2]int{start, len(events)})
+	}
+	return bounds
+}
+
+// estimateSize approximates the encoded size of an event, system props included.
+func (c *Client) estimateSize(event EventData) int {
+	systemPropsSize := c.encodedSystemPropsSize()
+	data, err := json.Marshal(event.Props)
+	if err != nil {
+		return eventOverhead + len(event.EventName) + systemPropsSize
+	}
+	return eventOverhead + len(event.EventName) + len(data) + systemPropsSize
+}
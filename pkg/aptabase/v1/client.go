@@ -1,58 +1,265 @@
 package aptabase
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/queue/v1"
 )
 
 type Client struct {
-	APIKey         string
-	BaseURL        string
-	HTTPClient     *http.Client
-	SessionID      string
-	LastTouch      time.Time
-	SessionTimeout time.Duration
-	eventChan      chan EventData
-	AppVersion     string
-	AppBuildNumber uint64
-	DebugMode      bool
-	quitChan       chan struct{}
-	wg             sync.WaitGroup
-	Quit           bool
-	Logger         *log.Logger // Logger field added
-	batch          []EventData
-}
+	APIKey          string
+	BaseURL         string
+	HTTPClient      *http.Client
+	SessionID       string
+	LastTouch       time.Time
+	sessionMu       sync.Mutex // Guards SessionID and LastTouch
+	sessionStore    SessionStore
+	sessionSaveMu   sync.Mutex    // Serializes sessionStore access, taken before sessionMu
+	sessionSaved    time.Time     // LastTouch as of the last save to sessionStore
+	sessionSavedID  string        // SessionID as of the last save to sessionStore
+	sessionDue      chan struct{} // Asks processQueue to save the session
+	SessionTimeout  time.Duration
+	eventChan       chan EventData
+	AppVersion      string
+	AppBuildNumber  uint64
+	DebugMode       bool
+	quitChan        chan struct{}
+	stopped         chan struct{}
+	stopOnce        sync.Once
+	requeueChan     chan []queuedEvent
+	sendSlots       chan struct{}   // Bounds the requests in flight, see maxConcurrentRequests
+	ctx             context.Context // Cancelled once Stop gives up waiting
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	Quit            bool // Set once Stop is called
+	stopping        atomic.Bool
+	Logger          *slog.Logger  // Silent unless WithLogger is given
+	batch           []queuedEvent // Events replayed from the disk queue, picked up by processQueue
+	appKey          AppKey
+	batchSize       int
+	flushInterval   time.Duration
+	maxPayloadBytes int
+	stopTimeout     time.Duration
+	queueSize       int
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+	propsMode       PropsMode
+	redactor        *Redactor
+	interceptors    []Interceptor
+	onBatch         BatchHook
+	retryPolicy     RetryPolicy
+	notBefore       atomic.Int64 // Unix nanoseconds before which no request is sent, from the last Retry-After
+	transport       Transport
+	gzipThreshold   int
 
-// NewClient Initializes a new client and begins processing events automagically.
-func NewClient(apiKey, appVersion string, appBuildNumber uint64, debugMode bool, baseURL string) *Client {
+	sampleRates       map[string]float64
+	defaultSampleRate float64
+	rateLimiter       *rateLimiter // Nil unless rate limits or quotas are set
+
+	consentMu       sync.Mutex // Guards consent and consentBuffer
+	consent         Consent
+	consentRequired bool
+	consentStore    ConsentStore
+	consentPolicy   ConsentPolicy
+	consentBuffer   []EventData // Prepared events waiting for consent
+	forgetChan      chan chan error
+
+	optOutEnv      string
+	disabledReason string // Set when the environment opts out of telemetry
 
+	// The session store and disk queue of a client disabled by the environment, never used
+	// but by ForgetLocalData, so it still wipes what earlier runs stored
+	disabledSessionStore SessionStore
+	disabledDiskQueueDir string
+
+	diskQueueDir     string
+	diskQueueOptions queue.Options
+	diskQueue        *queue.Queue
+
+	stats clientStats
+
+	systemPropsMu      sync.RWMutex // Guards systemPropsCache and systemPropsSize
+	systemPropsCache   map[string]interface{}
+	systemPropsSize    int           // Encoded size of systemPropsCache
+	systemPropsReady   chan struct{} // Closed once the system props were first collected
+	systemPropsAsync   bool
+	systemPropsRefresh time.Duration
+}
+
+// New initializes a new client from an App Key and begins processing events automagically.
+// It returns ErrInvalidAppKey, ErrUnknownRegion or ErrMissingHost instead of panicking on a bad key.
+// The client is a no-op when DO_NOT_TRACK or the WithOptOutEnv variable opts out, see Disabled.
+func New(appKey string, opts ...Option) (*Client, error) {
 	client := &Client{
-		APIKey:         apiKey,
-		HTTPClient:     &http.Client{Timeout: 10 * time.Second},
-		SessionTimeout: 1 * time.Hour,
-		eventChan:      make(chan EventData, 100),
-		AppVersion:     appVersion,
-		AppBuildNumber: appBuildNumber,
-		DebugMode:      debugMode,
-		quitChan:       make(chan struct{}),
-		Quit:           false,
-		Logger:         log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		batch:          make([]EventData, 0, 999),
-	}
-
-	client.BaseURL = client.determineHost(apiKey)
-	if strings.Contains(client.APIKey, "SH") {
-		client.BaseURL = baseURL
+		APIKey:           appKey,
+		HTTPClient:       &http.Client{Timeout: 10 * time.Second},
+		SessionTimeout:   defaultSessionTimeout,
+		quitChan:         make(chan struct{}),
+		stopped:          make(chan struct{}),
+		requeueChan:      make(chan []queuedEvent),
+		sendSlots:        make(chan struct{}, maxConcurrentRequests),
+		forgetChan:       make(chan chan error),
+		sessionDue:       make(chan struct{}, 1),
+		systemPropsReady: make(chan struct{}),
+		Quit:             false,
+		Logger:           slog.New(discardHandler{}),
+		batch:            make([]queuedEvent, 0, defaultBatchSize),
+		batchSize:        defaultBatchSize,
+		flushInterval:    defaultFlushInterval,
+		maxPayloadBytes:  defaultMaxPayloadBytes,
+		stopTimeout:      defaultStopTimeout,
+		queueSize:        defaultQueueSize,
+		overflowTimeout:  defaultOverflowTimeout,
+		retryPolicy:      DefaultRetryPolicy(),
+
+		defaultSampleRate: 1,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	key, err := ParseAppKey(appKey)
+	if err != nil {
+		return nil, err
+	}
+	host, err := key.Host()
+	if err != nil {
+		return nil, err
+	}
+	client.appKey = key
+	if client.BaseURL == "" {
+		client.BaseURL = host
+	}
+	if client.Logger == nil {
+		return nil, fmt.Errorf("%w: logger must not be nil", ErrInvalidOption)
+	}
+	if client.transport == nil {
+		if client.BaseURL == "" {
+			return nil, ErrMissingHost
+		}
+		if client.HTTPClient == nil {
+			return nil, fmt.Errorf("%w: HTTP client must not be nil", ErrInvalidOption)
+		}
+		transport := NewHTTPTransport(client.BaseURL, client.APIKey, client.HTTPClient)
+		transport.Logger = client.Logger
+		transport.GzipThreshold = client.gzipThreshold
+		client.transport = transport
+	}
+	if client.systemPropsRefresh < 0 {
+		return nil, fmt.Errorf("%w: system props refresh interval must not be negative, got %s", ErrInvalidOption, client.systemPropsRefresh)
+	}
+	if client.gzipThreshold < 0 {
+		return nil, fmt.Errorf("%w: gzip threshold must not be negative, got %d", ErrInvalidOption, client.gzipThreshold)
+	}
+	if client.batchSize <= 0 {
+		return nil, fmt.Errorf("%w: batch size must be positive, got %d", ErrInvalidOption, client.batchSize)
+	}
+	if client.queueSize <= 0 {
+		return nil, fmt.Errorf("%w: queue size must be positive, got %d", ErrInvalidOption, client.queueSize)
+	}
+	client.eventChan = make(chan EventData, client.queueSize)
+	if client.maxPayloadBytes <= 0 {
+		return nil, fmt.Errorf("%w: max payload bytes must be positive, got %d", ErrInvalidOption, client.maxPayloadBytes)
 	}
+	if client.flushInterval <= 0 {
+		return nil, fmt.Errorf("%w: flush interval must be positive, got %s", ErrInvalidOption, client.flushInterval)
+	}
+	if client.SessionTimeout <= 0 {
+		return nil, fmt.Errorf("%w: session timeout must be positive, got %s", ErrInvalidOption, client.SessionTimeout)
+	}
+	if client.overflowPolicy < OverflowBlock || client.overflowPolicy > OverflowError {
+		return nil, fmt.Errorf("%w: unknown overflow policy %d", ErrInvalidOption, client.overflowPolicy)
+	}
+	if client.propsMode < PropsReject || client.propsMode > PropsFlatten {
+		return nil, fmt.Errorf("%w: unknown props mode %d", ErrInvalidOption, client.propsMode)
+	}
+	if !validSampleRate(client.defaultSampleRate) {
+		return nil, fmt.Errorf("%w: default sample rate must be between 0 and 1, got %v", ErrInvalidOption, client.defaultSampleRate)
+	}
+	for name, rate := range client.sampleRates {
+		if !validSampleRate(rate) {
+			return nil, fmt.Errorf("%w: sample rate of %q must be between 0 and 1, got %v", ErrInvalidOption, name, rate)
+		}
+	}
+	if client.rateLimiter != nil {
+		if err := client.rateLimiter.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if client.redactor != nil {
+		if err := client.redactor.validate(); err != nil {
+			return nil, err
+		}
+	}
+	client.disabledReason = optOutReason(client.optOutEnv)
+	if client.disabledReason != "" {
+		// Nothing may touch the disk or the network, nor run the commands behind the system props
+		client.disabledDiskQueueDir, client.diskQueueDir = client.diskQueueDir, ""
+		client.disabledSessionStore, client.sessionStore = client.sessionStore, nil
+		client.consentStore = nil
+	}
+	client.consent = ConsentGranted
+	if client.consentRequired {
+		client.loadConsent()
+	}
+	if client.diskQueueDir != "" {
+		if err := client.openDiskQueue(); err != nil {
+			return nil, err
+		}
+	}
+
+	client.ctx, client.cancel = context.WithCancel(context.Background())
 	client.SessionID = client.NewSessionID()
 	client.LastTouch = time.Now().UTC()
-	client.Logger.Printf("Aptabase Go is ready to go! SDK Version: %s", GetVersion())
-	client.Logger.Printf("NewClient created with APIKey=%s, BaseURL=%s, SessionID=%s", client.APIKey, client.BaseURL, client.SessionID)
+	if client.sessionStore != nil {
+		client.restoreSession()
+	}
+	client.Logger.Info("Aptabase Go is ready to go!",
+		"sdkVersion", GetVersion(),
+		"appKey", client.appKey,
+		"baseURL", client.BaseURL,
+		"sessionId", client.SessionID,
+	)
+	if client.disabledReason != "" {
+		client.Logger.Info("Telemetry is disabled by the environment, events will be discarded", "reason", client.disabledReason)
+	}
+	client.startSystemProps()
 	go client.processQueue()
 
+	return client, nil
+}
+
+// AppKey returns the parsed App Key the client was created with.
+func (c *Client) AppKey() AppKey {
+	return c.appKey
+}
+
+// NewClient Initializes a new client and begins processing events automagically.
+// It panics if the client cannot be created; prefer New, which returns an error instead.
+// With debugMode set, debug logs are written to stderr.
+func NewClient(apiKey, appVersion string, appBuildNumber uint64, debugMode bool, baseURL string) *Client {
+	opts := []Option{
+		WithAppVersion(appVersion),
+		WithAppBuildNumber(appBuildNumber),
+		WithDebugMode(debugMode),
+	}
+	// Like before New existed, baseURL only applies to self-hosted App Keys
+	if key, err := ParseAppKey(apiKey); err == nil && key.IsSelfHosted() {
+		opts = append(opts, WithHost(baseURL))
+	}
+	if debugMode {
+		opts = append(opts, WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
+	client, err := New(apiKey, opts...)
+	if err != nil {
+		panic(err)
+	}
 	return client
 }
@@ -0,0 +1,303 @@
+package aptabase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Consent is whether the user agreed to share usage data.
+type Consent int
+
+const (
+	// ConsentUnknown means the user has not decided yet. Events follow the ConsentPolicy.
+	ConsentUnknown Consent = iota
+	// ConsentGranted lets events be sent.
+	ConsentGranted
+	// ConsentDenied discards every event.
+	ConsentDenied
+)
+
+func (c Consent) String() string {
+	switch c {
+	case ConsentUnknown:
+		return "unknown"
+	case ConsentGranted:
+		return "granted"
+	case ConsentDenied:
+		return "denied"
+	default:
+		return fmt.Sprintf("Consent(%d)", int(c))
+	}
+}
+
+// ConsentPolicy decides what happens to events tracked before the user decided.
+type ConsentPolicy int
+
+const (
+	// ConsentBuffer holds events in memory until SetConsent, which sends or discards them. It is the default.
+	ConsentBuffer ConsentPolicy = iota
+	// ConsentDiscard discards events until consent is granted.
+	ConsentDiscard
+)
+
+// maxConsentBuffer bounds the events ConsentBuffer holds; later ones are dropped.
+const maxConsentBuffer = 1000
+
+// ConsentStore persists the user's decision across runs.
+type ConsentStore interface {
+	// Load returns the stored decision, ConsentUnknown if there is none.
+	Load() (Consent, error)
+	// Save stores the decision.
+	Save(consent Consent) error
+}
+
+// FileConsentStore is a ConsentStore backed by a JSON file.
+type FileConsentStore struct {
+	Path string
+}
+
+type storedConsent struct {
+	Granted   bool      `json:"granted"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NewFileConsentStore creates a FileConsentStore using the file at path.
+func NewFileConsentStore(path string) *FileConsentStore {
+	return &FileConsentStore{Path: path}
+}
+
+// DefaultConsentStore returns a FileConsentStore for the App Key in StateDir.
+func DefaultConsentStore(appKey AppKey) (*FileConsentStore, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileConsentStore(filepath.Join(dir, "consent-"+appKey.Region+"-"+appKey.ID+".json")), nil
+}
+
+// Load reads the stored decision. A missing file means ConsentUnknown.
+func (s *FileConsentStore) Load() (Consent, error) {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return ConsentUnknown, nil
+	}
+	if err != nil {
+		return ConsentUnknown, err
+	}
+	defer f.Close()
+	if err := lockFile(f, false); err != nil {
+		return ConsentUnknown, fmt.Errorf("locking %s: %w", s.Path, err)
+	}
+	defer unlockFile(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil || len(data) == 0 {
+		return ConsentUnknown, err
+	}
+	var stored storedConsent
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return ConsentUnknown, fmt.Errorf("reading %s: %w", s.Path, err)
+	}
+	if stored.Granted {
+		return ConsentGranted, nil
+	}
+	return ConsentDenied, nil
+}
+
+// Save writes the decision, creating the file and its directory if needed.
+// Saving ConsentUnknown removes the file.
+func (s *FileConsentStore) Save(consent Consent) error {
+	if consent == ConsentUnknown {
+		if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(storedConsent{Granted: consent == ConsentGranted, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f, true); err != nil {
+		return fmt.Errorf("locking %s: %w", s.Path, err)
+	}
+	defer unlockFile(f)
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadConsent sets the initial decision from the consent store.
+func (c *Client) loadConsent() {
+	c.consent = ConsentUnknown
+	if c.consentStore == nil {
+		return
+	}
+	consent, err := c.consentStore.Load()
+	if err != nil {
+		c.Logger.Warn("Could not load the stored consent", "error", err)
+		return
+	}
+	c.consent = consent
+}
+
+// Consent returns the user's current decision. Clients created without WithConsent start out granted.
+func (c *Client) Consent() Consent {
+	c.consentMu.Lock()
+	defer c.consentMu.Unlock()
+	return c.consent
+}
+
+// SetConsent records the user's decision and saves it to the consent store, if any.
+// Granting consent queues the events buffered so far. Denying it discards them along with
+// every queued event and the disk queue; requests already being sent are not recalled.
+// The decision applies even when saving it fails.
+func (c *Client) SetConsent(granted bool) error {
+	consent := ConsentDenied
+	if granted {
+		consent = ConsentGranted
+	}
+
+	c.consentMu.Lock()
+	c.consent = consent
+	buffered := c.consentBuffer
+	c.consentBuffer = nil
+	var err error
+	if c.consentStore != nil {
+		err = c.consentStore.Save(consent)
+	}
+	c.consentMu.Unlock()
+
+	c.Logger.Debug("Consent changed", "consent", consent, "buffered", len(buffered))
+	if !granted {
+		c.stats.recordDropped(len(buffered), false)
+		// A stopped client has nothing left to purge
+		if purgeErr := c.purgeQueue(); !errors.Is(purgeErr, ErrClientStopped) {
+			err = errors.Join(err, purgeErr)
+		}
+		return err
+	}
+	for _, event := range buffered {
+		if enqueueErr := c.enqueue(event); enqueueErr != nil {
+			c.stats.recordDropped(1, false)
+		}
+	}
+	return err
+}
+
+// consentBlocks reports whether events are currently discarded for lack of consent,
+// letting TrackEvent skip preparing them.
+func (c *Client) consentBlocks() bool {
+	c.consentMu.Lock()
+	defer c.consentMu.Unlock()
+	return c.consent == ConsentDenied || (c.consent == ConsentUnknown && c.consentPolicy == ConsentDiscard)
+}
+
+// holdForConsent buffers or discards a prepared event unless consent is granted,
+// and reports whether it did.
+func (c *Client) holdForConsent(event EventData) bool {
+	c.consentMu.Lock()
+	defer c.consentMu.Unlock()
+	switch {
+	case c.consent == ConsentGranted:
+		return false
+	case c.consent == ConsentUnknown && c.consentPolicy == ConsentBuffer && len(c.consentBuffer) < maxConsentBuffer:
+		c.consentBuffer = append(c.consentBuffer, event)
+	default:
+		c.stats.recordDropped(1, false)
+	}
+	return true
+}
+
+// ForgetLocalData wipes everything the client stored about the user: events buffered until
+// consent, queued or waiting in the disk queue, and the stored session, which is replaced by a
+// new one. Requests already being sent are not recalled. The consent decision itself is kept.
+// A client disabled by the environment also wipes the session and disk queue earlier runs stored.
+func (c *Client) ForgetLocalData() error {
+	if c.stopping.Load() {
+		return ErrClientStopped
+	}
+
+	c.consentMu.Lock()
+	c.stats.recordDropped(len(c.consentBuffer), false)
+	c.consentBuffer = nil
+	c.consentMu.Unlock()
+
+	err := c.purgeQueue()
+	if errors.Is(err, ErrClientStopped) {
+		return err
+	}
+	errs := []error{err}
+	if c.disabledDiskQueueDir != "" {
+		errs = append(errs, c.resetDisabledDiskQueue())
+	}
+
+	c.sessionSaveMu.Lock()
+	c.sessionMu.Lock()
+	c.SessionID = c.NewSessionID()
+	c.LastTouch = time.Now().UTC()
+	c.sessionSaved, c.sessionSavedID = time.Time{}, ""
+	c.sessionMu.Unlock()
+	store := c.sessionStore
+	if c.disabledReason != "" {
+		store = c.disabledSessionStore
+	}
+	if clearer, ok := store.(interface{ Clear() error }); ok {
+		errs = append(errs, clearer.Clear())
+	}
+	c.sessionSaveMu.Unlock()
+
+	c.Logger.Info("Forgot local data")
+	return errors.Join(errs...)
+}
+
+// purgeQueue has processQueue discard the events it holds and empty the disk queue.
+func (c *Client) purgeQueue() error {
+	done := make(chan error, 1)
+	select {
+	case c.forgetChan <- done:
+		return <-done
+	case <-c.stopped:
+		return ErrClientStopped
+	}
+}
+
+// forget discards the events processQueue holds and empties the disk queue.
+// It runs on the processQueue goroutine.
+func (c *Client) forget(batch *[]queuedEvent) error {
+	n := len(*batch)
+	*batch = make([]queuedEvent, 0, c.batchSize)
+drain:
+	for {
+		select {
+		case <-c.eventChan:
+			n++
+		case requeued := <-c.requeueChan:
+			n += len(requeued)
+		default:
+			break drain
+		}
+	}
+	c.stats.recordDropped(n, true)
+	if c.diskQueue != nil {
+		return c.diskQueue.Reset()
+	}
+	return nil
+}
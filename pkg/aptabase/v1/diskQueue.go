@@ -0,0 +1,106 @@
+package aptabase
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/brycensranch/go-aptabase/pkg/queue/v1"
+)
+
+// queuedEvent is an event waiting in processQueue along with its record ID in the disk queue.
+// The ID is 0 when the event was not persisted.
+type queuedEvent struct {
+	EventData
+	queueID uint64
+}
+
+// openDiskQueue opens the disk queue configured with WithDiskQueue and loads the events
+// a previous run did not manage to deliver, so processQueue sends them first.
+// Unless consent is granted they are buffered or discarded like new events, and the queue is emptied.
+// It runs after loadConsent.
+func (c *Client) openDiskQueue() error {
+	q, err := queue.Open(c.diskQueueDir, c.diskQueueOptions)
+	if err != nil {
+		return err
+	}
+	records, err := q.Pending()
+	if err != nil {
+		q.Close()
+		return err
+	}
+
+	for _, rec := range records {
+		var event EventData
+		if err := json.Unmarshal(rec.Data, &event); err != nil {
+			c.Logger.Warn("Dropping unreadable event from the disk queue", "id", rec.ID, "error", err)
+			if err := q.Ack(rec.ID); err != nil {
+				c.Logger.Error("Error acknowledging event in the disk queue", "id", rec.ID, "error", err)
+			}
+			continue
+		}
+		c.batch = append(c.batch, queuedEvent{EventData: event, queueID: rec.ID})
+	}
+	if c.consent != ConsentGranted && len(records) > 0 {
+		for _, queued := range c.batch {
+			c.holdForConsent(queued.EventData)
+		}
+		c.batch = nil
+		if err := q.Reset(); err != nil {
+			q.Close()
+			return err
+		}
+	}
+	if len(c.batch) > 0 {
+		c.Logger.Info("Replaying events from the disk queue", "events", len(c.batch))
+		c.stats.recordQueued(len(c.batch))
+	}
+	c.diskQueue = q
+	return nil
+}
+
+// persistEvent appends the event to the disk queue, if one is configured.
+// Events that cannot be written are still sent, they just won't survive a crash.
+func (c *Client) persistEvent(event EventData) queuedEvent {
+	queued := queuedEvent{EventData: event}
+	if c.diskQueue == nil {
+		return queued
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		queued.queueID, err = c.diskQueue.Append(data)
+	}
+	if err != nil {
+		c.Logger.Error("Error writing event to the disk queue", "eventName", event.EventName, "error", err)
+	}
+	return queued
+}
+
+// ackEvents removes delivered events from the disk queue.
+func (c *Client) ackEvents(events []queuedEvent) {
+	if c.diskQueue == nil {
+		return
+	}
+	ids := make([]uint64, 0, len(events))
+	for _, event := range events {
+		if event.queueID != 0 {
+			ids = append(ids, event.queueID)
+		}
+	}
+	if err := c.diskQueue.Ack(ids...); err != nil {
+		c.Logger.Error("Error acknowledging events in the disk queue", "events", len(ids), "error", err)
+	}
+}
+
+// resetDisabledDiskQueue empties the disk queue of a client disabled by the environment,
+// which never opened it. A directory that does not exist is left alone.
+func (c *Client) resetDisabledDiskQueue() error {
+	if _, err := os.Stat(c.disabledDiskQueueDir); os.IsNotExist(err) {
+		return nil
+	}
+	q, err := queue.Open(c.disabledDiskQueueDir, c.diskQueueOptions)
+	if err != nil {
+		return err
+	}
+	return errors.Join(q.Reset(), q.Close())
+}
@@ -0,0 +1,32 @@
+package aptabase
+
+import "errors"
+
+var (
+	// ErrInvalidAppKey is returned when the App Key is not in the form "A-<REGION>-<ID>".
+	ErrInvalidAppKey = errors.New("aptabase: invalid app key format")
+
+	// ErrUnknownRegion is returned when the App Key references a region with no known host.
+	ErrUnknownRegion = errors.New("aptabase: unknown region")
+
+	// ErrMissingHost is returned when a self-hosted App Key is used without WithHost.
+	ErrMissingHost = errors.New("aptabase: self-hosted app key requires a host")
+
+	// ErrInvalidOption is returned when an Option is given an unusable value.
+	ErrInvalidOption = errors.New("aptabase: invalid option")
+
+	// ErrQueueFull is returned by TrackEvent when the event queue is full and the OverflowPolicy gives up.
+	ErrQueueFull = errors.New("aptabase: event queue is full")
+
+	// ErrInvalidProp is wrapped by the *PropError TrackEvent returns for props Aptabase would reject.
+	ErrInvalidProp = errors.New("aptabase: invalid prop")
+
+	// ErrInvalidEvent is returned by TrackStruct for values it cannot turn into an event.
+	ErrInvalidEvent = errors.New("aptabase: invalid event")
+
+	// ErrConsent is returned by Backfill unless the user granted consent.
+	ErrConsent = errors.New("aptabase: consent not granted")
+
+	// ErrClientStopped is returned by TrackEvent after Stop was called.
+	ErrClientStopped = errors.New("aptabase: client is stopped")
+)
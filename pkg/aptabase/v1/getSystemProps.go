@@ -1,12 +1,15 @@
 package aptabase
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"github.com/brycensranch/go-aptabase/pkg/device/v1"
 	"github.com/brycensranch/go-aptabase/pkg/locale"
 	"github.com/brycensranch/go-aptabase/pkg/osinfo/v1"
 	"runtime"
+	"time"
 )
 
 //go:embed VERSION
@@ -21,13 +24,17 @@ func GetVersion() string {
 	return SDKVersion
 }
 
-// systemProps retrieves system information using the osinfo package,
+// defaultSystemPropsSize is assumed by estimateSize until the system props are collected.
+const defaultSystemPropsSize = 512
+
+// collectSystemProps retrieves system information using the osinfo package,
 // and includes Client-specific details like AppVersion, AppBuildNumber, and DebugMode.
-func (c *Client) systemProps() (map[string]interface{}, error) {
+// It may read files and run commands, so clients cache its result, see systemProps.
+func (c *Client) collectSystemProps() map[string]interface{} {
 	osName, osVersion := osinfo.GetOSInfo()
 	deviceModel, err := device.GetDeviceModel()
-	if err != nil && c.DebugMode {
-		c.Logger.Printf("WARNING got error trying to get device model: %v", err)
+	if err != nil {
+		c.Logger.Debug("Could not get the device model", "error", err)
 	}
 
 	props := map[string]interface{}{
@@ -42,9 +49,86 @@ func (c *Client) systemProps() (map[string]interface{}, error) {
 		"deviceModel":    deviceModel,
 		"sdkVersion":     fmt.Sprintf("go-aptabase@%s", GetVersion()),
 	}
-	if c.DebugMode {
-		c.Logger.Printf("systemProps: %v", props)
+	c.Logger.Debug("Collected system props", "systemProps", props)
+
+	return props
+}
+
+// loadSystemProps collects the system props and caches them along with their encoded size.
+func (c *Client) loadSystemProps() {
+	props := c.collectSystemProps()
+	data, _ := json.Marshal(props)
+	c.systemPropsMu.Lock()
+	c.systemPropsCache = props
+	c.systemPropsSize = len(data)
+	c.systemPropsMu.Unlock()
+}
+
+// startSystemProps collects the system props, on a background goroutine if requested,
+// and keeps them up to date if a refresh interval is set.
+// A client disabled by the environment never collects them.
+func (c *Client) startSystemProps() {
+	if c.disabledReason != "" {
+		close(c.systemPropsReady)
+		return
+	}
+	load := func() {
+		c.loadSystemProps()
+		close(c.systemPropsReady)
+	}
+	if c.systemPropsAsync {
+		go load()
+	} else {
+		load()
 	}
+	if c.systemPropsRefresh > 0 {
+		go c.refreshSystemProps()
+	}
+}
 
-	return props, nil
+// refreshSystemProps collects the system props every refresh interval until Stop is called.
+func (c *Client) refreshSystemProps() {
+	ticker := time.NewTicker(c.systemPropsRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.loadSystemProps()
+		case <-c.quitChan:
+			return
+		}
+	}
+}
+
+// systemProps returns the cached system props, waiting for them to be collected if needed.
+// The map is shared and must not be modified.
+func (c *Client) systemProps(ctx context.Context) (map[string]interface{}, error) {
+	select {
+	case <-c.systemPropsReady:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.systemPropsMu.RLock()
+	defer c.systemPropsMu.RUnlock()
+	return c.systemPropsCache, nil
+}
+
+// SystemProps returns the system props reported with every event, such as the OS and app version.
+// They are collected once when the client starts, then every WithSystemPropsRefresh interval.
+// A client disabled by the environment returns nil.
+func (c *Client) SystemProps() map[string]interface{} {
+	<-c.systemPropsReady
+	c.systemPropsMu.RLock()
+	defer c.systemPropsMu.RUnlock()
+	return copyProps(c.systemPropsCache)
+}
+
+// encodedSystemPropsSize returns the size of the encoded system props without waiting for them.
+func (c *Client) encodedSystemPropsSize() int {
+	c.systemPropsMu.RLock()
+	defer c.systemPropsMu.RUnlock()
+	if c.systemPropsCache == nil {
+		return defaultSystemPropsSize
+	}
+	return c.systemPropsSize
 }
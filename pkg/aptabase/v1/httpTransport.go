@@ -0,0 +1,108 @@
+package aptabase
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// HTTPTransport posts events to the /api/v0/events endpoint of an Aptabase server.
+// It is the Transport used unless WithTransport is given.
+type HTTPTransport struct {
+	BaseURL    string
+	AppKey     string
+	HTTPClient *http.Client
+	Logger     *slog.Logger // Optional, nil disables logging
+
+	// GzipThreshold is the body size in bytes from which requests are gzip-compressed,
+	// 0 disables compression.
+	GzipThreshold int
+}
+
+// NewHTTPTransport creates an HTTPTransport for the server at baseURL.
+func NewHTTPTransport(baseURL, appKey string, httpClient *http.Client) *HTTPTransport {
+	return &HTTPTransport{
+		BaseURL:    baseURL,
+		AppKey:     appKey,
+		HTTPClient: httpClient,
+	}
+}
+
+// Send posts the events in a single request. Non-2xx responses are returned as a *StatusError.
+func (t *HTTPTransport) Send(ctx context.Context, events []Event) error {
+	_, err := t.send(ctx, events)
+	return err
+}
+
+// send is Send reporting the size of the request body as sent, compressed or not,
+// which the client counts in its Stats.
+func (t *HTTPTransport) send(ctx context.Context, events []Event) (int, error) {
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(events); err != nil {
+		return 0, Permanent(err)
+	}
+	data := payload.Bytes()
+	if t.Logger != nil && t.Logger.Enabled(ctx, slog.LevelDebug) {
+		t.Logger.DebugContext(ctx, "Sending events", "url", t.BaseURL+"/api/v0/events", "events", len(events), "bytes", len(data), "payload", string(data))
+	}
+
+	compressed := t.GzipThreshold > 0 && len(data) >= t.GzipThreshold
+	if compressed {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return 0, Permanent(err)
+		}
+		if err := gz.Close(); err != nil {
+			return 0, Permanent(err)
+		}
+		t.log(ctx, slog.LevelDebug, "Compressed events", "bytes", len(data), "compressedBytes", buf.Len())
+		data = buf.Bytes()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.BaseURL+"/api/v0/events", bytes.NewReader(data))
+	if err != nil {
+		return 0, Permanent(err)
+	}
+
+	req.Header.Set("App-Key", t.AppKey)
+	req.Header.Set("Content-Type", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := t.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			t.log(ctx, slog.LevelWarn, "Error closing response body", "error", err)
+		}
+	}(resp.Body)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.log(ctx, slog.LevelWarn, "Error reading response body", "statusCode", resp.StatusCode, "error", err)
+		return 0, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		t.log(ctx, slog.LevelDebug, "Aptabase rejected events", "statusCode", resp.StatusCode, "events", len(events), "body", string(respBody))
+		return 0, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Body:       string(respBody),
+		}
+	}
+	return len(data), nil
+}
+
+func (t *HTTPTransport) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if t.Logger != nil {
+		t.Logger.Log(ctx, level, msg, args...)
+	}
+}
@@ -0,0 +1,60 @@
+package aptabase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Interceptor inspects or changes an event right before it is sent. It may modify the event,
+// return a different one, or return nil to drop it. The event's Props are never nil.
+// An event whose interceptor fails or panics is dropped and the error logged.
+// Interceptors run again if a batch is requeued after exhausting its retries.
+type Interceptor func(ctx context.Context, event *Event) (*Event, error)
+
+// BatchHook sees every batch encoded as JSON before it is sent. It runs once per attempt to deliver
+// the batch from the queue, so again after the batch is requeued, but not for the retries in between.
+// The payload is encoded separately from the request body, which may be compressed or formatted differently.
+// It must not modify or retain the payload.
+type BatchHook func(ctx context.Context, events []Event, payload []byte)
+
+// intercept runs the event through the client's interceptors in order, returning nil if one drops it.
+func (c *Client) intercept(ctx context.Context, event *Event) *Event {
+	for i, interceptor := range c.interceptors {
+		name := event.EventName
+		var err error
+		event, err = runInterceptor(ctx, interceptor, event)
+		if err != nil {
+			c.Logger.Warn("BeforeSend interceptor failed, dropping event", "eventName", name, "interceptor", i, "error", err)
+			return nil
+		}
+		if event == nil {
+			c.Logger.Debug("BeforeSend interceptor dropped event", "eventName", name, "interceptor", i)
+			return nil
+		}
+	}
+	return event
+}
+
+// runInterceptor calls the interceptor, turning a panic into an error so it cannot crash the sending goroutine.
+func runInterceptor(ctx context.Context, interceptor Interceptor, event *Event) (result *Event, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("interceptor panicked: %v", r)
+		}
+	}()
+	return interceptor(ctx, event)
+}
+
+// runBatchHook hands the serialized batch to the OnBatch hook, if one is set.
+func (c *Client) runBatchHook(ctx context.Context, batch []Event) {
+	if c.onBatch == nil {
+		return
+	}
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		c.Logger.Warn("Error encoding batch for the OnBatch hook", "events", len(batch), "error", err)
+		return
+	}
+	c.onBatch(ctx, batch, payload)
+}
@@ -0,0 +1,29 @@
+package aptabase
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// discardHandler is a slog.Handler that drops every record, so the SDK is silent by default.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Redacted returns the App Key with all but the last four digits of its ID masked, e.g. "A-EU-******7890".
+func (k AppKey) Redacted() string {
+	visible := 4
+	if len(k.ID) <= visible*2 {
+		visible = 0
+	}
+	return k.Prefix + "-" + k.Region + "-" + strings.Repeat("*", len(k.ID)-visible) + k.ID[len(k.ID)-visible:]
+}
+
+// LogValue implements slog.LogValuer so App Keys are never logged in full.
+func (k AppKey) LogValue() slog.Value {
+	return slog.StringValue(k.Redacted())
+}
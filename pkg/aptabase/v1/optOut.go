@@ -0,0 +1,36 @@
+package aptabase
+
+import (
+	"os"
+	"strings"
+)
+
+// DoNotTrackEnv is the environment variable users set to opt out of telemetry in every tool
+// that honours it, see https://consoledonottrack.com.
+const DoNotTrackEnv = "DO_NOT_TRACK"
+
+// optOutReason returns why the environment opts out of telemetry, or "" if it does not.
+// DO_NOT_TRACK opts out when set to anything but an empty, "0" or "false" value, the app-specific
+// variable when set to "off", "0", "false", "no" or "disabled".
+func optOutReason(appEnv string) string {
+	if value := strings.TrimSpace(os.Getenv(DoNotTrackEnv)); value != "" && value != "0" && !strings.EqualFold(value, "false") {
+		return DoNotTrackEnv + "=" + value
+	}
+	if appEnv == "" {
+		return ""
+	}
+	value := strings.TrimSpace(os.Getenv(appEnv))
+	switch strings.ToLower(value) {
+	case "off", "0", "false", "no", "disabled":
+		return appEnv + "=" + value
+	}
+	return ""
+}
+
+// Disabled reports whether the client was put in no-op mode by the environment, and why,
+// e.g. "DO_NOT_TRACK=1". A disabled client accepts events but never queues, stores or sends them,
+// and neither collects system props nor reads or saves the consent decision.
+// ForgetLocalData still wipes the session and events stored by earlier runs.
+func (c *Client) Disabled() (disabled bool, reason string) {
+	return c.disabledReason != "", c.disabledReason
+}
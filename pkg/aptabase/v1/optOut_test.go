@@ -0,0 +1,75 @@
+package aptabase_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+	"github.com/brycensranch/go-aptabase/pkg/queue/v1"
+)
+
+func TestForgetLocalDataWhenDisabled(t *testing.T) {
+	dir := t.TempDir()
+	store := aptabase.NewFileSessionStore(filepath.Join(dir, "session.json"))
+	if err := store.Save("171455040012345678", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	queueDir := filepath.Join(dir, "queue")
+	q, err := queue.Open(queueDir, queue.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Append([]byte(`{"EventName":"from_an_earlier_run"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(aptabase.DoNotTrackEnv, "1")
+	client, err := aptabase.New("A-US-1234567890", aptabase.WithSessionStore(store), aptabase.WithDiskQueue(queueDir, queue.Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if disabled, _ := client.Disabled(); !disabled {
+		t.Fatal("client not disabled by DO_NOT_TRACK")
+	}
+	if id, _, err := store.Load(); err != nil || id == "" {
+		t.Fatalf("session touched before ForgetLocalData: %q, %v", id, err)
+	}
+
+	if err := client.ForgetLocalData(); err != nil {
+		t.Fatalf("ForgetLocalData: %v", err)
+	}
+	if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+		t.Errorf("session file left behind: %v", err)
+	}
+	q, err = queue.Open(queueDir, queue.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := q.Len(); got != 0 {
+		t.Errorf("%d events left in the disk queue", got)
+	}
+}
+
+func TestForgetLocalDataWhenDisabledWithoutFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(aptabase.DoNotTrackEnv, "1")
+	client, err := aptabase.New("A-US-1234567890", aptabase.WithSessionStore(aptabase.NewFileSessionStore(filepath.Join(dir, "session.json"))),
+		aptabase.WithDiskQueue(filepath.Join(dir, "queue"), queue.Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if err := client.ForgetLocalData(); err != nil {
+		t.Fatalf("ForgetLocalData: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("ForgetLocalData created %d files", len(entries))
+	}
+}
@@ -0,0 +1,280 @@
+package aptabase
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/queue/v1"
+)
+
+const (
+	defaultSessionTimeout  = 1 * time.Hour
+	defaultBatchSize       = 10
+	defaultFlushInterval   = 500 * time.Millisecond
+	defaultMaxPayloadBytes = 1 << 20
+	defaultStopTimeout     = 5 * time.Second
+)
+
+// Option configures a Client created with New.
+type Option func(*Client)
+
+// WithHost sets the base URL events are sent to, e.g. "https://aptabase.example.com".
+// It is required for self-hosted App Keys and overrides the region host otherwise.
+func WithHost(host string) Option {
+	return func(c *Client) {
+		c.BaseURL = host
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send events.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithLogger sets the logger used by the client. Clients are silent by default.
+// Payloads are only logged at slog.LevelDebug, and the App Key is always redacted.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
+
+// WithSessionStore persists the session so processes started within the session timeout share it.
+// Use DefaultSessionStore for a file in the user's state directory.
+func WithSessionStore(store SessionStore) Option {
+	return func(c *Client) {
+		c.sessionStore = store
+	}
+}
+
+// WithSessionTimeout sets how long a session may be idle before a new one is started.
+func WithSessionTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.SessionTimeout = timeout
+	}
+}
+
+// WithBatchSize sets how many events are queued before a batch is sent.
+// Batches above MaxEventsPerRequest are split into several requests.
+func WithBatchSize(size int) Option {
+	return func(c *Client) {
+		c.batchSize = size
+	}
+}
+
+// WithFlushInterval sets how often pending events are sent, even if the batch is not full.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.flushInterval = interval
+	}
+}
+
+// WithMaxPayloadBytes caps the approximate size of a single request, splitting batches that exceed it.
+func WithMaxPayloadBytes(n int) Option {
+	return func(c *Client) {
+		c.maxPayloadBytes = n
+	}
+}
+
+// WithQueueSize sets how many tracked events may wait for processQueue before the OverflowPolicy applies.
+func WithQueueSize(size int) Option {
+	return func(c *Client) {
+		c.queueSize = size
+	}
+}
+
+// WithOverflowPolicy sets what TrackEvent does when the event queue is full.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(c *Client) {
+		c.overflowPolicy = policy
+	}
+}
+
+// WithOverflowTimeout sets how long OverflowBlockTimeout waits for room in the queue.
+func WithOverflowTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.overflowTimeout = timeout
+	}
+}
+
+// WithPropsMode sets how TrackEvent handles prop values that are not strings, numbers or booleans.
+func WithPropsMode(mode PropsMode) Option {
+	return func(c *Client) {
+		c.propsMode = mode
+	}
+}
+
+// WithRedactor scrubs personal data from props before events are queued, see DefaultRedactionRules.
+func WithRedactor(redactor *Redactor) Option {
+	return func(c *Client) {
+		c.redactor = redactor
+	}
+}
+
+// WithBeforeSend adds interceptors that can enrich, rename, filter or drop events before they are sent.
+// Interceptors run in the order they were added, across calls.
+func WithBeforeSend(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// WithOnBatch sets a hook that sees the serialized form of every batch before it is sent.
+func WithOnBatch(hook BatchHook) Option {
+	return func(c *Client) {
+		c.onBatch = hook
+	}
+}
+
+// WithSampleRate sets the fraction of sessions, between 0 and 1, that report the named event.
+// Sampled events carry their rate in the SampleRateProp prop.
+func WithSampleRate(eventName string, rate float64) Option {
+	return func(c *Client) {
+		if c.sampleRates == nil {
+			c.sampleRates = make(map[string]float64)
+		}
+		c.sampleRates[eventName] = rate
+	}
+}
+
+// WithDefaultSampleRate sets the sample rate of events without one from WithSampleRate. It defaults to 1.
+func WithDefaultSampleRate(rate float64) Option {
+	return func(c *Client) {
+		c.defaultSampleRate = rate
+	}
+}
+
+// WithConsent makes the client wait for the user's consent, see SetConsent. The decision is loaded
+// from and saved to store, which may be nil to keep it in memory only; use DefaultConsentStore for
+// a file in the user's state directory. Until the user decides, events follow policy.
+func WithConsent(store ConsentStore, policy ConsentPolicy) Option {
+	return func(c *Client) {
+		c.consentRequired = true
+		c.consentStore = store
+		c.consentPolicy = policy
+	}
+}
+
+// WithOptOutEnv names an app-specific environment variable that disables telemetry when set to
+// "off", "0", "false", "no" or "disabled", e.g. MYAPP_TELEMETRY=off. DO_NOT_TRACK is always honoured.
+func WithOptOutEnv(name string) Option {
+	return func(c *Client) {
+		c.optOutEnv = name
+	}
+}
+
+// WithRateLimit limits how often the named event is tracked. Events over the limit are dropped
+// and reported in a RateLimitedEvent at the next flush.
+func WithRateLimit(eventName string, limit RateLimit) Option {
+	return func(c *Client) {
+		c.limiter().limits[eventName] = limit
+	}
+}
+
+// WithDefaultRateLimit limits how often each event without its own WithRateLimit is tracked.
+func WithDefaultRateLimit(limit RateLimit) Option {
+	return func(c *Client) {
+		c.limiter().defaultLimit = &limit
+	}
+}
+
+// WithSessionQuota caps the events tracked per session, 0 means no cap.
+// Events are counted in memory: a process resuming a stored session starts from zero.
+func WithSessionQuota(events int) Option {
+	return func(c *Client) {
+		c.limiter().sessionQuota = events
+	}
+}
+
+// WithProcessDailyQuota caps the events tracked per local calendar day, 0 means no cap.
+// Events are counted in memory, so the cap applies to each process on its own and starts over
+// when the process restarts.
+func WithProcessDailyQuota(events int) Option {
+	return func(c *Client) {
+		c.limiter().dailyQuota = events
+	}
+}
+
+// WithGzip compresses request bodies of at least threshold bytes, e.g. 1024.
+// It only applies to the default HTTP transport.
+func WithGzip(threshold int) Option {
+	return func(c *Client) {
+		c.gzipThreshold = threshold
+	}
+}
+
+// WithBackgroundSystemProps collects the system props on a background goroutine, so New returns
+// without waiting for the OS version, device model and locale lookups. Sends wait for them instead.
+func WithBackgroundSystemProps(enabled bool) Option {
+	return func(c *Client) {
+		c.systemPropsAsync = enabled
+	}
+}
+
+// WithSystemPropsRefresh collects the system props again every interval, 0 disables refreshing.
+func WithSystemPropsRefresh(interval time.Duration) Option {
+	return func(c *Client) {
+		c.systemPropsRefresh = interval
+	}
+}
+
+// WithDebugMode marks events as coming from a debug build. Use WithLogger to see the SDK's logs.
+func WithDebugMode(debug bool) Option {
+	return func(c *Client) {
+		c.DebugMode = debug
+	}
+}
+
+// WithAppVersion sets the application version reported with every event.
+func WithAppVersion(version string) Option {
+	return func(c *Client) {
+		c.AppVersion = version
+	}
+}
+
+// WithAppBuildNumber sets the application build number reported with every event.
+func WithAppBuildNumber(buildNumber uint64) Option {
+	return func(c *Client) {
+		c.AppBuildNumber = buildNumber
+	}
+}
+
+// WithStopTimeout sets how long Stop waits for pending events to be sent.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.stopTimeout = timeout
+	}
+}
+
+// WithRetryPolicy sets how failed batches are retried, use NoRetry to disable retries.
+// A Retry-After from Aptabase holds back every request until it passes, whatever the policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithTransport replaces the HTTP transport events are delivered with.
+// WithHost and WithHTTPClient have no effect when a transport is given.
+func WithTransport(transport Transport) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithDiskQueue persists queued events in dir so they survive crashes, network outages and Stop timeouts.
+// Events are only removed once Aptabase accepted them, and leftovers are sent by the next client using dir.
+// They are written once the client takes them off its in-memory queue, so a crash still loses the
+// events waiting there (see WithQueueSize).
+// Writes are fsynced once per second by default. queue.SyncAlways fsyncs every event instead,
+// which slows down the goroutine batching them.
+// The directory must not be shared by clients running at the same time.
+func WithDiskQueue(dir string, opts queue.Options) Option {
+	return func(c *Client) {
+		c.diskQueueDir = dir
+		c.diskQueueOptions = opts
+	}
+}
@@ -0,0 +1,110 @@
+package aptabase
+
+import (
+	"time"
+)
+
+// OverflowPolicy decides what TrackEvent does when the event queue is full,
+// e.g. because the network is stalled.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the queue. It is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowBlockTimeout waits up to the overflow timeout, then drops the event and returns ErrQueueFull.
+	OverflowBlockTimeout
+	// OverflowDropNewest drops the event being tracked.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued event to make room for the new one.
+	OverflowDropOldest
+	// OverflowError drops the event being tracked and returns ErrQueueFull.
+	OverflowError
+)
+
+const (
+	defaultQueueSize       = 100
+	defaultOverflowTimeout = 1 * time.Second
+)
+
+// enqueue hands the event to processQueue, applying the client's OverflowPolicy if the queue is full.
+// Stopping is checked before sending, since select picks a free slot in eventChan as readily as
+// the closed stopped channel.
+func (c *Client) enqueue(event EventData) error {
+	if c.stopping.Load() {
+		return ErrClientStopped
+	}
+	select {
+	case c.eventChan <- event:
+		c.queued()
+		return nil
+	case <-c.stopped:
+		return ErrClientStopped
+	default:
+	}
+
+	switch c.overflowPolicy {
+	case OverflowBlockTimeout:
+		timer := time.NewTimer(c.overflowTimeout)
+		defer timer.Stop()
+		select {
+		case c.eventChan <- event:
+			c.queued()
+			return nil
+		case <-c.stopped:
+			return ErrClientStopped
+		case <-timer.C:
+			c.Logger.Warn("Event queue is still full, dropping event", "eventName", event.EventName, "timeout", c.overflowTimeout)
+			return ErrQueueFull
+		}
+	case OverflowDropNewest:
+		c.Logger.Warn("Event queue is full, dropping event", "eventName", event.EventName)
+		c.stats.recordDropped(1, false)
+		return nil
+	case OverflowDropOldest:
+		for !c.stopping.Load() {
+			select {
+			case c.eventChan <- event:
+				c.queued()
+				return nil
+			case dropped := <-c.eventChan:
+				c.Logger.Warn("Event queue is full, dropping oldest event", "eventName", dropped.EventName)
+				c.stats.recordDropped(1, true)
+			}
+		}
+		return ErrClientStopped
+	case OverflowError:
+		return ErrQueueFull
+	default:
+		select {
+		case c.eventChan <- event:
+			c.queued()
+			return nil
+		case <-c.stopped:
+			return ErrClientStopped
+		}
+	}
+}
+
+// queued counts an event sent to eventChan. If processQueue has exited meanwhile it will never read
+// the event, so whatever is left in eventChan is counted as dropped instead.
+func (c *Client) queued() {
+	c.stats.recordQueued(1)
+	select {
+	case <-c.stopped:
+		c.discardQueued()
+	default:
+	}
+}
+
+// discardQueued empties eventChan once processQueue has exited, counting the events as dropped.
+func (c *Client) discardQueued() {
+	for {
+		select {
+		case event := <-c.eventChan:
+			c.Logger.Warn("Event queued while stopping, dropping it", "eventName", event.EventName)
+			c.stats.recordDropped(1, true)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package aptabase_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1/aptabasetest"
+)
+
+func TestOverflowWhenServerHangs(t *testing.T) {
+	srv := aptabasetest.NewServer("A-US-1234567890")
+	defer srv.Close()
+	srv.SetLatency(time.Hour)
+	client := srv.NewClient(t, aptabase.WithBatchSize(1), aptabase.WithQueueSize(5),
+		aptabase.WithOverflowPolicy(aptabase.OverflowError), aptabase.WithStopTimeout(100*time.Millisecond))
+
+	const events = 1000
+	full := 0
+	for i := 0; i < events; i++ {
+		err := client.Track("e", nil)
+		switch {
+		case errors.Is(err, aptabase.ErrQueueFull):
+			full++
+		case err != nil:
+			t.Fatalf("Track: %v", err)
+		}
+		time.Sleep(100 * time.Microsecond) // Give processQueue every chance to read the queue
+	}
+	if full < events-50 {
+		t.Errorf("%d events rejected with ErrQueueFull, want at least %d", full, events-50)
+	}
+	if got := srv.Requests(); got > 10 {
+		t.Errorf("%d requests in flight, want them bounded", got)
+	}
+
+	start := time.Now()
+	client.Stop()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Stop took %s with the server hanging", elapsed)
+	}
+	if stats := client.Stats(); stats.Dropped < uint64(full) {
+		t.Errorf("Dropped = %d, want at least the %d rejected events", stats.Dropped, full)
+	}
+}
@@ -1,68 +1,166 @@
 package aptabase
 
 import (
+	"context"
+	"errors"
 	"time"
 )
 
-// processQueue processes the queued events periodically, batching them into a single request.
+// maxBacklog bounds the events processQueue holds while requests fail or a Retry-After is pending.
+// Beyond it the oldest are dropped, or left to the disk queue for the next run if they were persisted.
+const maxBacklog = 1000
+
+// maxConcurrentRequests bounds the requests in flight. Once they all stall, processQueue stops reading
+// eventChan, so the queue fills up and the OverflowPolicy applies instead of requests piling up.
+const maxConcurrentRequests = 4
+
+// processQueue processes the queued events, sending them once the batch is full and on every flush interval.
 func (c *Client) processQueue() {
-	if (c.DebugMode) {
-	c.Logger.Printf("processQueue started")
-	}
-	batch := make([]EventData, 0, 999)
+	c.Logger.Debug("processQueue started", "replayed", len(c.batch))
+	batch := c.batch
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case event := <-c.eventChan:
-			if c.DebugMode {
-				c.Logger.Printf("processQueue received eventChan %s", event.EventName)
-			}
 			c.handleEvent(&batch, event)
+		case requeued := <-c.requeueChan:
+			c.takeRequeued(&batch, requeued)
+		case done := <-c.forgetChan:
+			done <- c.forget(&batch)
+		case <-c.sessionDue:
+			c.saveSession(false)
 		case <-c.quitChan:
+			c.drainEvents(&batch)
+			c.addRateLimitSummary(&batch)
+			c.flushBatch(&batch)
+			close(c.stopped)
+			return
+		case <-ticker.C:
+			c.addRateLimitSummary(&batch)
+			// Events keep piling up in the batch until the last Retry-After passes
+			if len(batch) > 0 && c.heldOff() <= 0 {
 				c.flushBatch(&batch)
-				batch = make([]EventData, 0, 999)
-		case <-time.After(500 * time.Millisecond):
-			if c.Quit {
-				c.flushBatch(&batch)
-				batch = make([]EventData, 0, 999)
+				batch = make([]queuedEvent, 0, c.batchSize)
 			}
 		}
 	}
 }
 
 // handleEvent processes an incoming event by appending it to the current batch.
-func (c *Client) handleEvent(batch *[]EventData, event EventData) {
-	if c.DebugMode {
-		c.Logger.Printf("processQueue received event: %+v", event)
+func (c *Client) handleEvent(batch *[]queuedEvent, event EventData) {
+	*batch = append(*batch, c.persistEvent(event))
+	c.trimBacklog(batch)
+	c.Logger.Debug("processQueue received event", "eventName", event.EventName, "batchSize", len(*batch))
+	if len(*batch) >= c.batchSize && c.heldOff() <= 0 {
+		c.sendBatch(*batch)
+		*batch = make([]queuedEvent, 0, c.batchSize)
 	}
-	*batch = append(*batch, event)
-	if c.DebugMode {
-		c.Logger.Printf("processQueue current batch: %v", *batch)
+}
+
+// sendBatch sends the events in the provided batch in the background, split into as many requests
+// as needed. Persisted events are only removed from the disk queue once the service accepted them.
+func (c *Client) sendBatch(batch []queuedEvent) {
+	events := make([]EventData, len(batch))
+	for i, queued := range batch {
+		events[i] = queued.EventData
 	}
-	if len(*batch) >= 10 {
-		c.sendBatch(*batch)
-		*batch = make([]EventData, 0, 999)
+	for _, bounds := range c.requestBounds(events) {
+		start, end := bounds[0], bounds[1]
+		c.sendRequest(batch[start:end:end], events[start:end:end])
 	}
 }
 
-// sendBatch sends the events in the provided batch and waits for completion.
-func (c *Client) sendBatch(batch []EventData) {
+// sendRequest sends events in a single request with retries, then acknowledges or requeues them.
+// It blocks processQueue until fewer than maxConcurrentRequests are in flight.
+func (c *Client) sendRequest(batch []queuedEvent, events []EventData) {
+	select {
+	case c.sendSlots <- struct{}{}:
+	case <-c.ctx.Done():
+		c.Logger.Warn("Gave up sending events on Stop", "events", len(batch))
+		c.stats.recordDropped(len(batch), true)
+		return
+	}
 	c.wg.Add(1)
-	go func(batchToSend []EventData) {
+	go func(batchToSend []queuedEvent) {
 		defer c.wg.Done()
 
-		err := c.sendEvents(batchToSend)
-		if err != nil {
-			c.Logger.Printf("Error sending events: %v", err)
+		sent, err := c.sendWithRetry(c.ctx, events)
+		<-c.sendSlots // Before requeue, which waits for processQueue
+		switch {
+		case err == nil:
+			c.stats.recordSent(sent)
+			c.stats.recordFiltered(len(batchToSend) - sent)
+			c.ackEvents(batchToSend)
+		case errors.Is(err, context.Canceled):
+			c.Logger.Warn("Gave up sending events on Stop", "events", len(batchToSend), "error", err)
+			c.stats.recordDropped(len(batchToSend), true)
+		case !IsRetryable(err):
+			// Aptabase rejected the events, sending them again would fail the same way.
+			c.Logger.Error("Dropping events that cannot be sent", "events", len(batchToSend), "error", err)
+			c.stats.recordFailed(len(batchToSend))
+			c.ackEvents(batchToSend)
+		default:
+			c.Logger.Warn("Error sending events, requeueing them", "events", len(batchToSend), "error", err)
+			c.stats.requeued.Add(uint64(len(batchToSend)))
+			c.requeue(batchToSend)
 		}
 	}(batch)
 }
 
+// requeue hands events that exhausted their retries back to processQueue for the next flush.
+// Once the client is stopping they are left to the disk queue, if one is configured.
+func (c *Client) requeue(events []queuedEvent) {
+	select {
+	case c.requeueChan <- events:
+	case <-c.stopped:
+		c.stats.recordDropped(len(events), true)
+	}
+}
+
+// takeRequeued puts requeued events back at the front of the batch, or discards them
+// if consent was denied while they were being sent.
+func (c *Client) takeRequeued(batch *[]queuedEvent, requeued []queuedEvent) {
+	if c.Consent() == ConsentDenied {
+		c.stats.recordDropped(len(requeued), true)
+		c.ackEvents(requeued)
+		return
+	}
+	*batch = append(requeued, *batch...)
+	c.trimBacklog(batch)
+}
+
+// trimBacklog drops the oldest events of the batch beyond maxBacklog. Persisted ones are not
+// acknowledged, so the disk queue still holds them for the next run.
+func (c *Client) trimBacklog(batch *[]queuedEvent) {
+	excess := len(*batch) - max(maxBacklog, c.batchSize)
+	if excess <= 0 {
+		return
+	}
+	c.Logger.Warn("Too many events waiting to be sent, dropping the oldest", "events", excess)
+	c.stats.recordDropped(excess, true)
+	*batch = (*batch)[excess:]
+}
+
+// drainEvents moves every event still buffered in eventChan or requeued into the batch without blocking.
+func (c *Client) drainEvents(batch *[]queuedEvent) {
+	for {
+		select {
+		case event := <-c.eventChan:
+			c.handleEvent(batch, event)
+		case requeued := <-c.requeueChan:
+			c.takeRequeued(batch, requeued)
+		default:
+			return
+		}
+	}
+}
+
 // flushBatch sends any remaining events in the batch before quitting.
-func (c *Client) flushBatch(batch *[]EventData) {
+func (c *Client) flushBatch(batch *[]queuedEvent) {
 	if len(*batch) > 0 {
-		if (c.DebugMode) { c.Logger.Printf("Flushing events: %v", *batch) }
+		c.Logger.Debug("Flushing events", "events", len(*batch))
 		c.sendBatch(*batch)
-		finishedFlushing = true;
 	}
 }
@@ -0,0 +1,217 @@
+package aptabase
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// PropsMode decides how TrackEvent handles prop values Aptabase does not accept.
+// Aptabase only stores strings, numbers and booleans.
+type PropsMode int
+
+const (
+	// PropsReject returns an error for any prop that is not a string, number or boolean. It is the default.
+	PropsReject PropsMode = iota
+	// PropsCoerce converts common types to accepted ones: time.Time becomes an RFC 3339 string,
+	// time.Duration a number of milliseconds, errors and fmt.Stringers their text, and named
+	// string, number and boolean types their underlying value. Anything else is rejected.
+	PropsCoerce
+	// PropsFlatten coerces like PropsCoerce and also flattens nested maps into dotted keys,
+	// e.g. {"user": {"plan": "pro"}} becomes {"user.plan": "pro"}.
+	PropsFlatten
+)
+
+// PropError is returned by TrackEvent when a prop cannot be sent. It wraps ErrInvalidProp.
+type PropError struct {
+	Key    string // Name of the failing prop, dotted for flattened maps
+	Value  any
+	Reason string
+}
+
+func (e *PropError) Error() string {
+	return fmt.Sprintf("aptabase: invalid prop %q: %s", e.Key, e.Reason)
+}
+
+func (e *PropError) Unwrap() error { return ErrInvalidProp }
+
+// normalizeProps validates the event's props according to the client's PropsMode, replacing them
+// with a converted copy when values had to be coerced or flattened. The caller's map is never modified.
+func (c *Client) normalizeProps(event *EventData) error {
+	if len(event.Props) == 0 {
+		return nil
+	}
+	if c.propsMode == PropsReject {
+		for key, value := range event.Props {
+			if err := checkProp(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	props := make(map[string]interface{}, len(event.Props))
+	if err := c.addProps(props, "", reflect.ValueOf(event.Props)); err != nil {
+		return err
+	}
+	event.Props = props
+	return nil
+}
+
+// addProps adds the entries of the map m to props, prefixing their keys.
+func (c *Client) addProps(props map[string]interface{}, prefix string, m reflect.Value) error {
+	iter := m.MapRange()
+	for iter.Next() {
+		key := prefix + iter.Key().String()
+		value := iter.Value().Interface()
+
+		if c.propsMode == PropsFlatten {
+			nested := reflect.ValueOf(value)
+			if nested.Kind() == reflect.Map && nested.Type().Key().Kind() == reflect.String {
+				if err := c.addProps(props, key+".", nested); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		coerced, err := coerceProp(key, value)
+		if err != nil {
+			return err
+		}
+		if _, exists := props[key]; exists {
+			return &PropError{Key: key, Value: value, Reason: "conflicts with a flattened key"}
+		}
+		props[key] = coerced
+	}
+	return nil
+}
+
+// checkProp reports whether value is one of the types Aptabase accepts.
+func checkProp(key string, value any) error {
+	switch v := value.(type) {
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		json.Number:
+		return nil
+	case float32:
+		return checkFloat(key, float64(v))
+	case float64:
+		return checkFloat(key, v)
+	case nil:
+		return &PropError{Key: key, Value: value, Reason: "value is nil"}
+	default:
+		return &PropError{Key: key, Value: value, Reason: fmt.Sprintf("unsupported type %T, use a string, number or boolean", value)}
+	}
+}
+
+func checkFloat(key string, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return &PropError{Key: key, Value: v, Reason: "number is not finite"}
+	}
+	return nil
+}
+
+// coerceProp converts value to a string, number or boolean if it has a sensible representation.
+func coerceProp(key string, value any) (any, error) {
+	if checkProp(key, value) == nil {
+		return value, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		// Calling Error or String on a typed nil would likely panic
+		if rv.IsNil() {
+			return nil, &PropError{Key: key, Value: value, Reason: fmt.Sprintf("value is a nil %T", value)}
+		}
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return v.Milliseconds(), nil
+	case error:
+		return v.Error(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), checkFloat(key, rv.Float())
+	}
+	return nil, checkProp(key, value)
+}
+
+// Props is a set of event props built with typed setters, so invalid prop types don't compile:
+//
+//	client.Track("checkout", aptabase.NewProps().String("plan", "pro").Int("items", 3))
+//
+// The setters modify and return the receiver. Use NewProps or a literal, a nil Props cannot be set.
+type Props map[string]interface{}
+
+// PropValue is the set of types Aptabase accepts as prop values.
+type PropValue interface {
+	string | bool |
+		int | int8 | int16 | int32 | int64 |
+		uint | uint8 | uint16 | uint32 | uint64 |
+		float32 | float64
+}
+
+// NewProps returns an empty Props.
+func NewProps() Props {
+	return make(Props, 4)
+}
+
+// String sets a string prop.
+func (p Props) String(key, value string) Props {
+	p[key] = value
+	return p
+}
+
+// Int sets a number prop.
+func (p Props) Int(key string, value int) Props {
+	p[key] = value
+	return p
+}
+
+// Float sets a number prop.
+func (p Props) Float(key string, value float64) Props {
+	p[key] = value
+	return p
+}
+
+// Bool sets a boolean prop.
+func (p Props) Bool(key string, value bool) Props {
+	p[key] = value
+	return p
+}
+
+// Duration sets a number prop holding the duration in milliseconds.
+func (p Props) Duration(key string, value time.Duration) Props {
+	p[key] = value.Milliseconds()
+	return p
+}
+
+// Time sets a string prop holding the time in RFC 3339 format, in UTC.
+func (p Props) Time(key string, value time.Time) Props {
+	p[key] = value.UTC().Format(time.RFC3339Nano)
+	return p
+}
+
+// Set sets a prop of any accepted type. It is a function because Go methods cannot have type parameters.
+func Set[T PropValue](p Props, key string, value T) Props {
+	p[key] = value
+	return p
+}
@@ -0,0 +1,105 @@
+package aptabase
+
+import (
+	"errors"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type (
+	plan  string
+	level int
+	seats uint8
+	ratio float64
+	flag  bool
+)
+
+func TestNormalizeProps(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	tests := []struct {
+		name   string
+		mode   PropsMode
+		props  map[string]interface{}
+		want   map[string]interface{} // Ignored when errKey is set
+		errKey string                 // Key of the expected PropError
+	}{
+		{"accepted types", PropsReject, map[string]interface{}{"s": "x", "b": true, "i": 1, "u": uint64(2), "f": 1.5, "f32": float32(2.5)},
+			map[string]interface{}{"s": "x", "b": true, "i": 1, "u": uint64(2), "f": 1.5, "f32": float32(2.5)}, ""},
+		{"reject time", PropsReject, map[string]interface{}{"at": when}, nil, "at"},
+		{"reject named type", PropsReject, map[string]interface{}{"plan": plan("pro")}, nil, "plan"},
+		{"reject nested map", PropsReject, map[string]interface{}{"user": map[string]interface{}{"plan": "pro"}}, nil, "user"},
+		{"reject nil", PropsReject, map[string]interface{}{"none": nil}, nil, "none"},
+		{"reject NaN", PropsReject, map[string]interface{}{"nan": math.NaN()}, nil, "nan"},
+		{"reject Inf", PropsReject, map[string]interface{}{"inf": float32(math.Inf(-1))}, nil, "inf"},
+
+		{"coerce common types", PropsCoerce, map[string]interface{}{
+			"at":    when,
+			"took":  1500 * time.Millisecond,
+			"err":   errors.New("boom"),
+			"ip":    net.IPv4(10, 0, 0, 1),
+			"plain": 3,
+		}, map[string]interface{}{
+			"at":    "2024-05-01T10:00:00Z",
+			"took":  int64(1500),
+			"err":   "boom",
+			"ip":    "10.0.0.1",
+			"plain": 3,
+		}, ""},
+		{"coerce named types", PropsCoerce, map[string]interface{}{"plan": plan("pro"), "level": level(-3), "seats": seats(4), "ratio": ratio(0.5), "flag": flag(true)},
+			map[string]interface{}{"plan": "pro", "level": int64(-3), "seats": uint64(4), "ratio": 0.5, "flag": true}, ""},
+		{"coerce named NaN", PropsCoerce, map[string]interface{}{"ratio": ratio(math.NaN())}, nil, "ratio"},
+		{"coerce named Inf", PropsCoerce, map[string]interface{}{"ratio": ratio(math.Inf(1))}, nil, "ratio"},
+		{"coerce NaN", PropsCoerce, map[string]interface{}{"nan": math.NaN()}, nil, "nan"},
+		{"coerce typed nil error", PropsCoerce, map[string]interface{}{"err": (*PropError)(nil)}, nil, "err"},
+		{"coerce typed nil stringer", PropsCoerce, map[string]interface{}{"ip": net.IP(nil)}, nil, "ip"},
+		{"coerce nil", PropsCoerce, map[string]interface{}{"none": nil}, nil, "none"},
+		{"coerce rejects slices", PropsCoerce, map[string]interface{}{"tags": []string{"a"}}, nil, "tags"},
+		{"coerce rejects structs", PropsCoerce, map[string]interface{}{"s": struct{ A int }{1}}, nil, "s"},
+		{"coerce keeps nested maps", PropsCoerce, map[string]interface{}{"user": map[string]interface{}{"plan": "pro"}}, nil, "user"},
+
+		{"flatten", PropsFlatten, map[string]interface{}{
+			"user": map[string]interface{}{"plan": plan("pro"), "org": map[string]int{"size": 3}},
+			"at":   when,
+		}, map[string]interface{}{"user.plan": "pro", "user.org.size": 3, "at": "2024-05-01T10:00:00Z"}, ""},
+		{"flatten named map", PropsFlatten, map[string]interface{}{"p": Props{"a": 1}}, map[string]interface{}{"p.a": 1}, ""},
+		{"flatten empty map", PropsFlatten, map[string]interface{}{"user": map[string]interface{}{}, "x": 1}, map[string]interface{}{"x": 1}, ""},
+		{"flatten key conflict", PropsFlatten, map[string]interface{}{"user.plan": "a", "user": map[string]interface{}{"plan": "b"}}, nil, "user.plan"},
+		{"flatten nested error key", PropsFlatten, map[string]interface{}{"user": map[string]interface{}{"nan": math.NaN()}}, nil, "user.nan"},
+		{"flatten rejects non-string keys", PropsFlatten, map[string]interface{}{"m": map[int]string{1: "a"}}, nil, "m"},
+		{"flatten typed nil map", PropsFlatten, map[string]interface{}{"m": map[string]interface{}(nil), "x": 1}, map[string]interface{}{"x": 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{propsMode: tt.mode}
+			original := make(map[string]interface{}, len(tt.props))
+			for k, v := range tt.props {
+				original[k] = v
+			}
+			event := &EventData{EventName: "e", Props: tt.props}
+
+			err := c.normalizeProps(event)
+			if tt.errKey != "" {
+				var propErr *PropError
+				if !errors.As(err, &propErr) || !errors.Is(err, ErrInvalidProp) {
+					t.Fatalf("err = %v, want a PropError", err)
+				}
+				if propErr.Key != tt.errKey {
+					t.Errorf("PropError.Key = %q, want %q", propErr.Key, tt.errKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeProps: %v", err)
+			}
+			if !reflect.DeepEqual(event.Props, tt.want) {
+				t.Errorf("props = %#v, want %#v", event.Props, tt.want)
+			}
+			if !reflect.DeepEqual(tt.props, original) {
+				t.Errorf("caller's props modified: %v", tt.props)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package aptabase
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitedEvent is the name of the summary event reporting events dropped by rate limits and quotas.
+// Its props hold the "total" count and one "event.<name>" count per limited event name.
+const RateLimitedEvent = "aptabase_rate_limited"
+
+// errRateLimited is returned by prepareEvent for events over a rate limit or quota.
+// It is not an error for the caller: TrackEvent returns nil and the event is counted in the summary.
+var errRateLimited = errors.New("aptabase: event rate limited")
+
+// RateLimit is a token bucket: up to Burst events at once, refilled at Rate events per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) validate() error {
+	if !(l.Rate > 0) || math.IsInf(l.Rate, 0) || l.Burst < 1 {
+		return fmt.Errorf("%w: rate limit needs a positive rate and burst, got %v/s and %d", ErrInvalidOption, l.Rate, l.Burst)
+	}
+	return nil
+}
+
+// maxCountedSessions bounds the sessions the session quota counts events of. Beyond it the counts
+// start over: events are rarely tracked for older sessions once a new one started.
+const maxCountedSessions = 100
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter enforces the per-event rate limits and the session and daily quotas, and counts
+// the events it rejects until they are reported. Like the quotas, its counts live in memory and
+// start over with every process.
+type rateLimiter struct {
+	mu           sync.Mutex
+	limits       map[string]RateLimit
+	defaultLimit *RateLimit
+	sessionQuota int // 0 means unlimited
+	dailyQuota   int // 0 means unlimited
+
+	buckets       map[string]*tokenBucket
+	sessionCounts map[string]int // Events per session, so events of other sessions don't reset the count
+	day           string         // Local date counted in dayCount
+	dayCount      int
+	limited       map[string]int // Rejected events per name since the last summary
+}
+
+// limiter returns the client's rate limiter, creating it for the options that configure it.
+func (c *Client) limiter() *rateLimiter {
+	if c.rateLimiter == nil {
+		c.rateLimiter = &rateLimiter{
+			limits:        make(map[string]RateLimit),
+			buckets:       make(map[string]*tokenBucket),
+			sessionCounts: make(map[string]int),
+			limited:       make(map[string]int),
+		}
+	}
+	return c.rateLimiter
+}
+
+func (l *rateLimiter) validate() error {
+	if l.defaultLimit != nil {
+		if err := l.defaultLimit.validate(); err != nil {
+			return err
+		}
+	}
+	for name, limit := range l.limits {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("%w (event %q)", err, name)
+		}
+	}
+	if l.sessionQuota < 0 || l.dailyQuota < 0 {
+		return fmt.Errorf("%w: quotas must not be negative", ErrInvalidOption)
+	}
+	return nil
+}
+
+// allow reports whether the event fits the limits, consuming a token and quota if it does.
+// Rejected events are only counted for the summary when report is set.
+func (l *rateLimiter) allow(event *EventData, now time.Time, report bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessionCount, counted := l.sessionCounts[event.SessionId]
+	if !counted && len(l.sessionCounts) >= maxCountedSessions {
+		clear(l.sessionCounts)
+	}
+	if day := now.Format(time.DateOnly); day != l.day {
+		l.day, l.dayCount = day, 0
+	}
+	if (l.sessionQuota > 0 && sessionCount >= l.sessionQuota) || (l.dailyQuota > 0 && l.dayCount >= l.dailyQuota) {
+		if report {
+			l.limited[event.EventName]++
+		}
+		return false
+	}
+
+	limit, ok := l.limits[event.EventName]
+	if !ok && l.defaultLimit != nil {
+		limit, ok = *l.defaultLimit, true
+	}
+	if ok {
+		bucket := l.buckets[event.EventName]
+		if bucket == nil {
+			bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+			l.buckets[event.EventName] = bucket
+		}
+		bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+		bucket.last = now
+		if bucket.tokens < 1 {
+			if report {
+				l.limited[event.EventName]++
+			}
+			return false
+		}
+		bucket.tokens--
+	}
+
+	l.sessionCounts[event.SessionId]++
+	l.dayCount++
+	return true
+}
+
+// summary returns the props of the summary event and resets the counts, or nil if nothing was limited.
+func (l *rateLimiter) summary() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.limited) == 0 {
+		return nil
+	}
+	props := make(map[string]interface{}, len(l.limited)+1)
+	total := 0
+	for name, count := range l.limited {
+		props["event."+name] = count
+		total += count
+	}
+	props["total"] = total
+	clear(l.limited)
+	return props
+}
+
+// addRateLimitSummary appends a RateLimitedEvent to the batch if events were limited since the last one.
+// Like any other event it is held or discarded unless consent is granted.
+// It runs on the processQueue goroutine, right before a flush.
+func (c *Client) addRateLimitSummary(batch *[]queuedEvent) {
+	if c.rateLimiter == nil {
+		return
+	}
+	props := c.rateLimiter.summary()
+	if props == nil {
+		return
+	}
+	c.Logger.Warn("Events were dropped by rate limits", "events", props["total"])
+	event := EventData{
+		EventName: RateLimitedEvent,
+		Props:     props,
+		Timestamp: time.Now(),
+		SessionId: c.EvalSessionID(),
+	}
+	if c.holdForConsent(event) {
+		return
+	}
+	c.stats.recordQueued(1)
+	*batch = append(*batch, c.persistEvent(event))
+}
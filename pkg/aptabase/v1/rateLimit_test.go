@@ -0,0 +1,132 @@
+package aptabase
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// step is an event passed to rateLimiter.allow and whether it should be allowed.
+type step struct {
+	name    string
+	session string
+	at      time.Duration // After the start of the test
+	allowed bool
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		steps []step
+	}{
+		{"no limits", nil, []step{
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, true},
+		}},
+		{"burst then refill", []Option{WithRateLimit("e", RateLimit{Rate: 2, Burst: 2})}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, false},
+			{"e", "s1", 250 * time.Millisecond, false},
+			{"e", "s1", 500 * time.Millisecond, true},
+			{"e", "s1", 500 * time.Millisecond, false},
+			{"e", "s1", time.Hour, true},
+			{"e", "s1", time.Hour, true},
+			{"e", "s1", time.Hour, false},
+		}},
+		{"limit per event name", []Option{WithRateLimit("e", RateLimit{Rate: 1, Burst: 1})}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, false},
+			{"other", "s1", 0, true},
+			{"other", "s1", 0, true},
+		}},
+		{"default limit", []Option{WithDefaultRateLimit(RateLimit{Rate: 1, Burst: 1}), WithRateLimit("e", RateLimit{Rate: 1, Burst: 2})}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, true},
+			{"a", "s1", 0, true},
+			{"a", "s1", 0, false},
+			{"b", "s1", 0, true},
+		}},
+		{"session quota", []Option{WithSessionQuota(2)}, []step{
+			{"e", "s1", 0, true},
+			{"f", "s1", 0, true},
+			{"e", "s1", time.Hour, false},
+			{"e", "s2", time.Hour, true},
+		}},
+		{"session quota across sessions", []Option{WithSessionQuota(2)}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s2", 0, true},
+			{"e", "s1", 0, true},
+			{"e", "s2", 0, true},
+			{"e", "s1", 0, false},
+			{"e", "s2", 0, false},
+		}},
+		{"daily quota", []Option{WithProcessDailyQuota(2)}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s2", time.Hour, true},
+			{"e", "s3", 2 * time.Hour, false},
+			{"e", "s3", 24 * time.Hour, true},
+		}},
+		{"rejected events use no quota", []Option{WithRateLimit("e", RateLimit{Rate: 1, Burst: 1}), WithSessionQuota(2)}, []step{
+			{"e", "s1", 0, true},
+			{"e", "s1", 0, false},
+			{"e", "s1", 0, false},
+			{"f", "s1", 0, true},
+			{"f", "s1", 0, false},
+		}},
+	}
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			for _, opt := range tt.opts {
+				opt(c)
+			}
+			l := c.limiter()
+			for i, s := range tt.steps {
+				event := &EventData{EventName: s.name, SessionId: s.session}
+				if got := l.allow(event, start.Add(s.at), true); got != s.allowed {
+					t.Fatalf("step %d (%s in %s at %s): allowed = %v, want %v", i, s.name, s.session, s.at, got, s.allowed)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterSessionCountsBounded(t *testing.T) {
+	c := &Client{}
+	WithSessionQuota(1)(c)
+	l := c.limiter()
+	now := time.Now()
+	for i := 0; i < 3*maxCountedSessions; i++ {
+		l.allow(&EventData{EventName: "e", SessionId: time.Duration(i).String()}, now, true)
+	}
+	if got := len(l.sessionCounts); got > maxCountedSessions {
+		t.Errorf("%d sessions counted, want at most %d", got, maxCountedSessions)
+	}
+}
+
+func TestRateLimiterSummary(t *testing.T) {
+	c := &Client{}
+	WithRateLimit("e", RateLimit{Rate: 1, Burst: 1})(c)
+	WithRateLimit("f", RateLimit{Rate: 1, Burst: 1})(c)
+	l := c.limiter()
+	now := time.Now()
+
+	if got := l.summary(); got != nil {
+		t.Fatalf("summary before any event = %v, want nil", got)
+	}
+	for _, name := range []string{"e", "e", "e", "f", "f"} {
+		l.allow(&EventData{EventName: name, SessionId: "s1"}, now, true)
+	}
+	l.allow(&EventData{EventName: "f", SessionId: "s1"}, now, false) // Not reported, e.g. without consent
+
+	want := map[string]interface{}{"total": 3, "event.e": 2, "event.f": 1}
+	if got := l.summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("summary = %v, want %v", got, want)
+	}
+	if got := l.summary(); got != nil {
+		t.Errorf("second summary = %v, want the counts reset", got)
+	}
+}
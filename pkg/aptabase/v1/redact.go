@@ -0,0 +1,268 @@
+package aptabase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactAction is what a RedactRule does to the props it matches.
+type RedactAction int
+
+const (
+	// RedactDrop removes the prop from the event.
+	RedactDrop RedactAction = iota
+	// RedactMask replaces the matched text, or the whole value for key rules, with "[redacted]".
+	RedactMask
+	// RedactHash replaces the matched text, or the whole value for key rules, with a salted
+	// HMAC-SHA256, so values can still be counted and compared without being readable.
+	RedactHash
+)
+
+func (a RedactAction) String() string {
+	switch a {
+	case RedactDrop:
+		return "drop"
+	case RedactMask:
+		return "mask"
+	case RedactHash:
+		return "hash"
+	default:
+		return fmt.Sprintf("RedactAction(%d)", int(a))
+	}
+}
+
+// redactedMask replaces values redacted with RedactMask.
+const redactedMask = "[redacted]"
+
+// RedactRule matches props by key, by value, or both.
+// A rule with Keys or KeyPattern applies to the props whose key matches, acting on the whole value
+// unless ValuePattern is also set. A rule with only ValuePattern applies to every string prop.
+type RedactRule struct {
+	Name         string                  // Reported in the redaction log
+	Keys         []string                // Prop keys matched case-insensitively
+	KeyPattern   *regexp.Regexp          // Prop keys matched by pattern
+	ValuePattern *regexp.Regexp          // Text within string values to redact
+	Validate     func(match string) bool // Optional filter of ValuePattern matches, e.g. a Luhn check
+	Action       RedactAction
+}
+
+// Redaction records a prop changed by a Redactor. It never contains the original value.
+type Redaction struct {
+	Key    string
+	Rule   string
+	Action RedactAction
+}
+
+// Redactor scrubs personal data from props before events are queued, so it is neither sent nor
+// written to the disk queue. Rules are applied in order; a dropped prop is not looked at further.
+type Redactor struct {
+	Rules []RedactRule
+	Salt  []byte // Key of RedactHash, required when a rule hashes
+}
+
+// NewRedactor creates a Redactor applying the given rules, see DefaultRedactionRules.
+func NewRedactor(salt []byte, rules ...RedactRule) *Redactor {
+	return &Redactor{Rules: rules, Salt: salt}
+}
+
+// DefaultRedactionRules returns rules dropping props named like credentials and masking
+// emails, IP addresses, paths under the home directory, tokens and credit card numbers.
+// Change the Action of a rule to hash values instead.
+func DefaultRedactionRules() []RedactRule {
+	rules := []RedactRule{
+		{
+			Name:       "credential",
+			KeyPattern: credentialKey,
+			Action:     RedactDrop,
+		},
+		{
+			Name:         "email",
+			ValuePattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+			Action:       RedactMask,
+		},
+		{
+			Name:         "ip",
+			ValuePattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|\b(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}\b`),
+			Validate:     func(match string) bool { return net.ParseIP(match) != nil },
+			Action:       RedactMask,
+		},
+		{
+			Name:         "token",
+			ValuePattern: regexp.MustCompile(`\beyJ[\w-]+\.[\w-]+\.[\w-]+|\b(?:sk|pk|ghp|gho|ghs|xox[abp])[-_][A-Za-z0-9_-]{10,}|(?i:bearer)\s+\S+`),
+			Action:       RedactMask,
+		},
+		{
+			Name:         "credit_card",
+			ValuePattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			Validate:     luhnValid,
+			Action:       RedactMask,
+		},
+	}
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		rules = append(rules, RedactRule{
+			Name:         "home_path",
+			ValuePattern: regexp.MustCompile(regexp.QuoteMeta(home) + `[^\s"']*`),
+			// Only the home directory itself or paths below it, not siblings such as /rootfs
+			Validate: func(match string) bool {
+				return len(match) == len(home) || match[len(home)] == '/' || match[len(home)] == '\\'
+			},
+			Action: RedactMask,
+		})
+	}
+	return rules
+}
+
+// credentialKey matches prop keys naming a credential: the credential is the last snake, kebab or
+// dotted segment, such as "api_key", "access_token" or "user.password", or the last camelCase word,
+// such as "authToken". Keys merely mentioning one, like "token_count", "auth_method" or "author", are left alone.
+var credentialKey = regexp.MustCompile(`(?:^|[_.-])(?i:password|passwd|secret|token|api[_-]?key|secret[_-]?key|private[_-]?key|authorization|cookie|session[_-]?key)$` +
+	`|[a-z0-9](?:Password|Passwd|Secret|Token|ApiKey|SecretKey|PrivateKey|Authorization|Cookie|SessionKey)$`)
+
+// luhnValid reports whether the digits in match form a card number passing the Luhn checksum.
+func luhnValid(match string) bool {
+	sum, n := 0, 0
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// Redact returns a copy of props with the rules applied, along with what was redacted.
+// props is returned as is when nothing matched.
+func (r *Redactor) Redact(props map[string]interface{}) (map[string]interface{}, []Redaction) {
+	var redacted map[string]interface{}
+	var report []Redaction
+	for key, value := range props {
+		newValue, keep, redactions := r.redactProp(key, value)
+		if len(redactions) == 0 {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]interface{}, len(props))
+			for k, v := range props {
+				redacted[k] = v
+			}
+		}
+		if keep {
+			redacted[key] = newValue
+		} else {
+			delete(redacted, key)
+		}
+		report = append(report, redactions...)
+	}
+	if redacted == nil {
+		return props, nil
+	}
+	sort.SliceStable(report, func(i, j int) bool { return report[i].Key < report[j].Key })
+	return redacted, report
+}
+
+// redactProp applies the rules to a single prop and reports whether it is kept.
+func (r *Redactor) redactProp(key string, value any) (any, bool, []Redaction) {
+	var redactions []Redaction
+	for _, rule := range r.Rules {
+		hasKeyMatch := len(rule.Keys) > 0 || rule.KeyPattern != nil
+		if hasKeyMatch && !rule.matchesKey(key) {
+			continue
+		}
+
+		if rule.ValuePattern == nil {
+			redactions = append(redactions, Redaction{Key: key, Rule: rule.Name, Action: rule.Action})
+			if rule.Action == RedactDrop {
+				return nil, false, redactions
+			}
+			value = r.replace(rule.Action, fmt.Sprint(value))
+			continue
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		matched := false
+		text = rule.ValuePattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.Validate != nil && !rule.Validate(match) {
+				return match
+			}
+			matched = true
+			return r.replace(rule.Action, match)
+		})
+		if !matched {
+			continue
+		}
+		redactions = append(redactions, Redaction{Key: key, Rule: rule.Name, Action: rule.Action})
+		if rule.Action == RedactDrop {
+			return nil, false, redactions
+		}
+		value = text
+	}
+	return value, true, redactions
+}
+
+func (rule *RedactRule) matchesKey(key string) bool {
+	for _, k := range rule.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return rule.KeyPattern != nil && rule.KeyPattern.MatchString(key)
+}
+
+func (r *Redactor) replace(action RedactAction, text string) string {
+	if action != RedactHash {
+		return redactedMask
+	}
+	mac := hmac.New(sha256.New, r.Salt)
+	mac.Write([]byte(text))
+	// 96 bits are plenty to tell values apart, and too short to be taken for a token by later rules
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// validate checks that hashing rules have a salt to hash with.
+func (r *Redactor) validate() error {
+	for _, rule := range r.Rules {
+		if rule.Action == RedactHash && len(r.Salt) == 0 {
+			return fmt.Errorf("%w: redaction rule %q hashes values but the redactor has no salt", ErrInvalidOption, rule.Name)
+		}
+	}
+	return nil
+}
+
+// redactProps scrubs the event's props with the client's Redactor, if it has one.
+func (c *Client) redactProps(event *EventData) {
+	if c.redactor == nil || len(event.Props) == 0 {
+		return
+	}
+	props, report := c.redactor.Redact(event.Props)
+	if len(report) == 0 {
+		return
+	}
+	event.Props = props
+	if c.Logger.Enabled(c.ctx, slog.LevelDebug) {
+		redacted := make([]string, len(report))
+		for i, r := range report {
+			redacted[i] = r.Key + ":" + r.Rule + ":" + r.Action.String()
+		}
+		c.Logger.Debug("Redacted props", "eventName", event.EventName, "redacted", redacted)
+	}
+}
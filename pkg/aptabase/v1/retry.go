@@ -0,0 +1,206 @@
+package aptabase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how a batch is retried after a transient failure,
+// such as a network error, a 5xx response or a 429 Too Many Requests.
+type RetryPolicy struct {
+	MaxAttempts     int           // Total attempts including the first one, 0 means no limit besides MaxElapsedTime
+	InitialInterval time.Duration // Delay before the first retry
+	MaxInterval     time.Duration // Upper bound of a single delay, Retry-After excluded
+	Multiplier      float64       // Growth factor applied to the delay after every attempt
+	Jitter          float64       // Randomization factor in [0, 1], 0.5 spreads delays by ±50%
+	MaxElapsedTime  time.Duration // Time after which retrying stops, 0 means no limit besides MaxAttempts
+}
+
+// DefaultRetryPolicy returns the policy used by clients unless WithRetryPolicy is given.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     5,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxElapsedTime:  2 * time.Minute,
+	}
+}
+
+// NoRetry is a RetryPolicy that gives up after the first attempt.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// StatusError is returned when Aptabase answers with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Parsed from the Retry-After header, 0 if absent
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("aptabase: unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed if it is sent again.
+// Validation errors (4xx other than 408 and 429) are permanent.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+// permanentError marks failures that retrying cannot fix, such as events that cannot be encoded.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// IsRetryable reports whether a failed send is worth retrying.
+// Network errors and transient status codes are, validation errors and cancellations are not.
+// A joined error, such as MultiTransport's, is retryable if any of its errors is.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if joined, ok := e.(interface{ Unwrap() []error }); ok {
+			for _, member := range joined.Unwrap() {
+				if IsRetryable(member) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// backoff returns the delay before the given retry, starting at 1, with jitter applied.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	interval := float64(p.InitialInterval)
+	for i := 1; i < retry; i++ {
+		interval *= p.Multiplier
+		if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+			interval = float64(p.MaxInterval)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		interval += interval * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(interval)
+}
+
+// holdOff keeps every request of the client from being sent for the given Retry-After,
+// including requests for events requeued once their retries gave up.
+func (c *Client) holdOff(retryAfter time.Duration) {
+	until := time.Now().Add(retryAfter).UnixNano()
+	for {
+		current := c.notBefore.Load()
+		if current >= until || c.notBefore.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
+// heldOff returns how long until the last Retry-After passes, 0 or less once it has.
+func (c *Client) heldOff() time.Duration {
+	return time.Until(time.Unix(0, c.notBefore.Load()))
+}
+
+// sendWithRetry sends events, retrying transient failures according to the client's RetryPolicy.
+// Every attempt waits for the last Retry-After the client received to pass.
+// It returns how many events were sent, fewer than given when interceptors dropped some,
+// or the last error once the policy is exhausted or the error is permanent.
+func (c *Client) sendWithRetry(ctx context.Context, events []EventData) (int, error) {
+	batch, err := c.buildBatch(ctx, events)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+	c.runBatchHook(ctx, batch)
+
+	if wait := c.heldOff(); wait > 0 {
+		c.Logger.Debug("Waiting for Retry-After before sending events", "events", len(batch), "delay", wait)
+		if err := sleepCtx(ctx, wait); err != nil {
+			return 0, err
+		}
+	}
+	policy := c.retryPolicy
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := c.sendEvents(ctx, batch)
+		if err == nil {
+			return len(batch), nil
+		}
+		// Honoured even when this was the last attempt, the next batch must wait for it too
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			c.holdOff(statusErr.RetryAfter)
+		}
+		if !IsRetryable(err) {
+			return 0, err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return 0, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := policy.backoff(attempt)
+		if wait := c.heldOff(); wait > delay {
+			delay = wait
+		}
+		if policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+			return 0, fmt.Errorf("giving up after %s: %w", time.Since(start).Round(time.Millisecond), err)
+		}
+
+		c.stats.retried.Add(1)
+		c.Logger.Debug("Sending events failed, retrying", "attempt", attempt, "events", len(batch), "delay", delay, "error", err)
+		if sleepErr := sleepCtx(ctx, delay); sleepErr != nil {
+			return 0, fmt.Errorf("%w (last error: %v)", sleepErr, err)
+		}
+	}
+}
+
+// sleepCtx waits for the delay to pass or ctx to be done, returning ctx.Err() in the latter case.
+func sleepCtx(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package aptabase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1/aptabasetest"
+)
+
+// waitForRequests waits until the server received at least n requests.
+func waitForRequests(t *testing.T, srv *aptabasetest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Requests() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d requests, want %d", srv.Requests(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryAfterHoldsBackLaterRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  aptabase.RetryPolicy
+		limited int // Requests answered with 429
+	}{
+		{"no retry", aptabase.NoRetry, 1},
+		{"last attempt", aptabase.RetryPolicy{MaxAttempts: 2, InitialInterval: 10 * time.Millisecond, Multiplier: 1}, 2},
+		{"beyond max elapsed time", aptabase.RetryPolicy{InitialInterval: 10 * time.Millisecond, Multiplier: 1, MaxElapsedTime: 100 * time.Millisecond}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := aptabasetest.NewServer("A-US-1234567890")
+			defer srv.Close()
+			srv.RateLimitNext(tt.limited, 2*time.Second)
+			client := srv.NewClient(t, aptabase.WithRetryPolicy(tt.policy), aptabase.WithFlushInterval(20*time.Millisecond))
+
+			client.Track("first", nil)
+			waitForRequests(t, srv, 1)
+			time.Sleep(50 * time.Millisecond) // Let a retry on the last attempt happen, if any
+			sent := srv.Requests()
+			client.Track("second", nil)
+			time.Sleep(time.Second)
+			if got := srv.Requests(); got != sent {
+				t.Fatalf("%d requests sent during the Retry-After, want none", got-sent)
+			}
+
+			srv.WaitForEvent(t, "first")
+			srv.WaitForEvent(t, "second")
+		})
+	}
+}
+
+func TestBacklogIsBounded(t *testing.T) {
+	srv := aptabasetest.NewServer("A-US-1234567890")
+	defer srv.Close()
+	srv.RateLimitNext(1, time.Minute)
+	client := srv.NewClient(t, aptabase.WithRetryPolicy(aptabase.NoRetry), aptabase.WithFlushInterval(10*time.Millisecond),
+		aptabase.WithStopTimeout(10*time.Millisecond))
+
+	client.Track("first", nil)
+	waitForRequests(t, srv, 1)
+	const events = 1500
+	for i := 0; i < events; i++ {
+		client.Track("e", nil)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Stats().QueueDepth > 1000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats = %+v, want the backlog capped at 1000 events", client.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := client.Stats(); stats.Dropped < events+1-1000 {
+		t.Errorf("Dropped = %d, want at least %d", stats.Dropped, events+1-1000)
+	}
+}
@@ -0,0 +1,52 @@
+package aptabase
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// SampleRateProp is the prop holding the sample rate of events that were sampled,
+// so dashboards can re-weight counts by 1/sampleRate.
+const SampleRateProp = "sampleRate"
+
+// errSampledOut is returned by prepareEvent for events left out by sampling. It is not an error
+// for the caller: TrackEvent returns nil.
+var errSampledOut = errors.New("aptabase: event sampled out")
+
+// sampleRate returns the fraction of sessions that report the named event.
+func (c *Client) sampleRate(eventName string) float64 {
+	if rate, ok := c.sampleRates[eventName]; ok {
+		return rate
+	}
+	return c.defaultSampleRate
+}
+
+// sample reports whether the event is kept, adding SampleRateProp to the props of kept events
+// whose rate is below 1. The decision hashes the session and event name, so a session either
+// reports every occurrence of an event or none.
+func (c *Client) sample(event *EventData) bool {
+	rate := c.sampleRate(event.EventName)
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(event.SessionId))
+	h.Write([]byte{0})
+	h.Write([]byte(event.EventName))
+	if float64(h.Sum64())/math.MaxUint64 >= rate {
+		return false
+	}
+
+	props := make(map[string]interface{}, len(event.Props)+1)
+	for key, value := range event.Props {
+		props[key] = value
+	}
+	props[SampleRateProp] = rate
+	event.Props = props
+	return true
+}
+
+func validSampleRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
@@ -1,97 +1,100 @@
 package aptabase
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
-	"log"
-	"net/http"
+	"context"
+	"errors"
 	"time"
 )
 
-var finishedFlushing = false;
-
-// sendEvents sends a batch of events to the tracking service in a single request.
-func (c *Client) sendEvents(events []EventData) error {
-	if  len(events) == 0 && c.DebugMode {
-		c.Logger.Printf("sendEvents called with no events to send! woah")
-		return nil
-	}
-	c.wg.Add(1)
-	defer c.wg.Done()
-	systemProps, err := c.systemProps()
+// buildBatch turns events into the wire format and runs them through the BeforeSend interceptors.
+// Events dropped by an interceptor are left out of the returned batch.
+func (c *Client) buildBatch(ctx context.Context, events []EventData) ([]Event, error) {
+	systemProps, err := c.systemProps(ctx)
 	if err != nil {
-		c.Logger.Printf("Error getting system properties: %v\n", err)
-		return err
+		c.Logger.Error("Error getting system properties", "error", err)
+		return nil, err
 	}
 
-	// Prepare the batch of events
-	var batch []map[string]interface{}
+	batch := make([]Event, 0, len(events))
 	for _, event := range events {
-		if c.DebugMode {
-			log.Printf("Event: %s\nData: %v\nSystemProps: %v\n", event.EventName, event.Props, systemProps)
+		sessionID := event.SessionId
+		if sessionID == "" {
+			// Only events persisted by an SDK that resolved sessions at send time get here
+			sessionID = c.EvalSessionID()
+		}
+		wire := &Event{
+			Timestamp:   event.Timestamp.UTC().Truncate(time.Millisecond),
+			SessionID:   sessionID,
+			SystemProps: systemProps,
+			EventName:   event.EventName,
+			Props:       event.Props,
+		}
+		if len(c.interceptors) > 0 {
+			// Interceptors may modify props, which must not leak into a requeued event or the cached system props
+			wire.Props = copyProps(event.Props)
+			if wire.Props == nil {
+				wire.Props = make(map[string]interface{})
+			}
+			wire.SystemProps = copyProps(systemProps)
+		}
+		if wire = c.intercept(ctx, wire); wire != nil {
+			batch = append(batch, *wire)
 		}
-
-		// Add event to the batch
-		batch = append(batch, map[string]interface{}{
-			"timestamp":   time.Now().UTC().Format(time.RFC3339),
-			"sessionId":   c.EvalSessionID(),
-			"systemProps": systemProps,
-			"eventName":   event.EventName,
-			"props":       event.Props,
-		})
-	}
-	data, err := json.MarshalIndent(batch, "", "  ")
-	if err != nil {
-		c.Logger.Printf("Error marshalling event data: %v\n", err)
-		return err
 	}
-	if string(data) == "null" {
-		c.Logger.Printf("Event data is null!! Bug?\n")
-		c.Logger.Printf("Batch %v\n", batch)
-		c.Logger.Printf("Events %v\n", events)
+	return batch, nil
+}
+
+// sendEvents sends a batch of events to the tracking service in a single request.
+func (c *Client) sendEvents(ctx context.Context, batch []Event) error {
+	if len(batch) == 0 {
+		c.Logger.Debug("sendEvents called with no events to send! woah")
 		return nil
 	}
-	c.Logger.Printf("Sending data:\n%s", string(data))
-	req, err := http.NewRequest("POST", c.BaseURL+"/api/v0/events", bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("App-Key", c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	c.Logger.Printf("Sending events to %s", c.BaseURL)
+	c.wg.Add(1)
+	defer c.wg.Done()
 
-	resp, err := c.HTTPClient.Do(req)
+	c.stats.inFlight.Add(1)
+	start := time.Now()
+	size, err := c.send(ctx, batch)
+	latency := time.Since(start)
+	c.stats.inFlight.Add(-1)
+	c.stats.recordAttempt(latency, size, err)
 	if err != nil {
-		return err
-	}
-	defer func(Body io.ReadCloser) {
-		if err := Body.Close(); err != nil {
-			c.Logger.Printf("Error closing response body: %v", err)
+		attrs := []any{"events", len(batch), "latency", latency, "error", err}
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			attrs = append(attrs, "statusCode", statusErr.StatusCode)
 		}
-	}(resp.Body)
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.Logger.Printf("Error reading response body: %v", err)
+		c.Logger.Warn("Sending events failed", attrs...)
 		return err
 	}
+	c.Logger.Debug("Events tracked successfully!", "events", len(batch), "latency", latency)
+	return nil
+}
 
-	var respJSON map[string]interface{}
-	err = json.Unmarshal(respBody, &respJSON)
-	if err != nil {
-		c.Logger.Printf("Failed to unmarshal response body, logging raw body: %s", string(respBody))
-		respJSON = map[string]interface{}{"raw_body": string(respBody)} // Store raw body as fallback for logging
-		return err
+// send hands the batch to the transport and returns the size of the request body.
+// Only HTTPTransport knows the exact size, it is estimated for other transports.
+func (c *Client) send(ctx context.Context, batch []Event) (int, error) {
+	if t, ok := c.transport.(*HTTPTransport); ok {
+		return t.send(ctx, batch)
 	}
-
-	if resp.StatusCode >= 300 {
-		respJSONBytes, _ := json.Marshal(respJSON)
-		c.Logger.Printf("TrackEvent failed with status code %d at %s: %s", resp.StatusCode, resp.Request.URL, respJSONBytes)
-		return err
+	if err := c.transport.Send(ctx, batch); err != nil {
+		return 0, err
 	}
+	size := 2 // The enclosing brackets
+	for _, event := range batch {
+		size += c.estimateSize(EventData{EventName: event.EventName, Props: event.Props})
+	}
+	return size, nil
+}
 
-	c.Logger.Println("Events tracked successfully!")
-	return nil
+func copyProps(props map[string]interface{}) map[string]interface{} {
+	if props == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(props))
+	for key, value := range props {
+		copied[key] = value
+	}
+	return copied
 }
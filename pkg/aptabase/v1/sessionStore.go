@@ -0,0 +1,154 @@
+package aptabase
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sessionSaveInterval bounds how often an unchanged session is written back to the store.
+const sessionSaveInterval = 1 * time.Minute
+
+// SessionStore persists the current session, so short-lived processes started
+// within the session timeout of each other report the same session.
+type SessionStore interface {
+	// Load returns the stored session, or an empty id if there is none.
+	Load() (id string, lastTouch time.Time, err error)
+	// Save stores the session.
+	Save(id string, lastTouch time.Time) error
+}
+
+// FileSessionStore is a SessionStore backed by a JSON file, locked while it is read or written
+// so processes running at the same time don't corrupt it.
+type FileSessionStore struct {
+	Path string
+}
+
+type storedSession struct {
+	SessionID string    `json:"sessionId"`
+	LastTouch time.Time `json:"lastTouch"`
+}
+
+// NewFileSessionStore creates a FileSessionStore using the file at path.
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{Path: path}
+}
+
+// DefaultSessionStore returns a FileSessionStore for the App Key in StateDir.
+func DefaultSessionStore(appKey AppKey) (*FileSessionStore, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileSessionStore(filepath.Join(dir, "session-"+appKey.Region+"-"+appKey.ID+".json")), nil
+}
+
+// Load reads the stored session. A missing file is not an error.
+func (s *FileSessionStore) Load() (string, time.Time, error) {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+	if err := lockFile(f, false); err != nil {
+		return "", time.Time{}, fmt.Errorf("locking %s: %w", s.Path, err)
+	}
+	defer unlockFile(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil || len(data) == 0 {
+		return "", time.Time{}, err
+	}
+	var session storedSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return "", time.Time{}, fmt.Errorf("reading %s: %w", s.Path, err)
+	}
+	return session.SessionID, session.LastTouch, nil
+}
+
+// Save writes the session, creating the file and its directory if needed.
+func (s *FileSessionStore) Save(id string, lastTouch time.Time) error {
+	data, err := json.Marshal(storedSession{SessionID: id, LastTouch: lastTouch})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f, true); err != nil {
+		return fmt.Errorf("locking %s: %w", s.Path, err)
+	}
+	defer unlockFile(f)
+
+	// Truncate only once the lock is held, so readers never see a half-written file.
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Clear removes the stored session. A missing file is not an error.
+func (s *FileSessionStore) Clear() error {
+	if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// restoreSession adopts the stored session if it has not expired yet.
+func (c *Client) restoreSession() {
+	id, lastTouch, err := c.sessionStore.Load()
+	if err != nil {
+		c.Logger.Warn("Could not load the stored session", "error", err)
+		return
+	}
+	if id == "" || time.Since(lastTouch) > c.SessionTimeout {
+		return
+	}
+	c.SessionID = id
+	c.LastTouch = lastTouch.UTC()
+	c.sessionSaved = c.LastTouch
+	c.sessionSavedID = id
+	c.Logger.Debug("Restored session", "sessionId", id, "lastTouch", lastTouch)
+}
+
+// saveSession writes the session to the store when forced, new or last saved a while ago.
+// It runs on the processQueue goroutine and on Stop, never while holding sessionMu,
+// so TrackEvent does not wait for the store.
+func (c *Client) saveSession(force bool) {
+	if c.sessionStore == nil {
+		return
+	}
+	c.sessionSaveMu.Lock()
+	defer c.sessionSaveMu.Unlock()
+
+	c.sessionMu.Lock()
+	id, lastTouch := c.SessionID, c.LastTouch
+	due := force || id != c.sessionSavedID || lastTouch.Sub(c.sessionSaved) >= sessionSaveInterval
+	c.sessionMu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := c.sessionStore.Save(id, lastTouch); err != nil {
+		c.Logger.Warn("Could not save the session", "error", err)
+		return
+	}
+	c.sessionMu.Lock()
+	c.sessionSaved, c.sessionSavedID = lastTouch, id
+	c.sessionMu.Unlock()
+}
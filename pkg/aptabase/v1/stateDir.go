@@ -0,0 +1,32 @@
+package aptabase
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// StateDir returns the per-user directory the SDK keeps its state in:
+// $XDG_STATE_HOME/aptabase (or ~/.local/state/aptabase) on Linux and BSDs,
+// ~/Library/Application Support/aptabase on macOS and %LocalAppData%\aptabase on Windows.
+func StateDir() (string, error) {
+	var base string
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		base, err = os.UserCacheDir()
+	case "darwin", "ios":
+		base, err = os.UserConfigDir()
+	default:
+		base = os.Getenv("XDG_STATE_HOME")
+		if base == "" {
+			var home string
+			home, err = os.UserHomeDir()
+			base = filepath.Join(home, ".local", "state")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "aptabase"), nil
+}
@@ -0,0 +1,156 @@
+package aptabase
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of a client's delivery metrics, see Client.Stats.
+type Stats struct {
+	Queued   uint64 // Events accepted by TrackEvent, plus events replayed from the disk queue
+	Sent     uint64 // Events accepted by Aptabase
+	Retried  uint64 // Send attempts that failed and were retried
+	Requeued uint64 // Events handed back to the queue after exhausting their retries
+	Dropped  uint64 // Events discarded for invalid props, without consent, by the OverflowPolicy, by ForgetLocalData, beyond the backlog of unsent events, or around Stop
+	Failed   uint64 // Events Aptabase rejected permanently
+	Filtered uint64 // Events dropped by a BeforeSend interceptor
+	Sampled  uint64 // Events left out by sampling, not counted in Queued
+	Limited  uint64 // Events over a rate limit or quota, not counted in Queued
+
+	QueueDepth int64 // Events tracked but not yet sent, failed or dropped
+	InFlight   int64 // Requests currently being sent
+
+	BytesSent          uint64        // Payload bytes of successful requests, estimated for non-HTTP transports
+	SendAttempts       uint64        // Requests handed to the transport, retries included
+	AverageSendLatency time.Duration // Mean duration of a single send attempt
+	TotalSendLatency   time.Duration // Sum of the durations of all send attempts
+
+	// SendLatencyHistogram counts send attempts per bucket of SendLatencyBuckets, the last
+	// element counting attempts slower than the largest bucket. Counts are not cumulative.
+	SendLatencyHistogram []uint64
+
+	LastError     error     // Error of the most recent failed send attempt
+	LastErrorTime time.Time // When LastError happened
+	LastSuccess   time.Time // When a batch was last accepted
+}
+
+// sendLatencyBuckets are the upper bounds of the send latency histogram.
+var sendLatencyBuckets = [...]time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// SendLatencyBuckets returns the upper bounds of the buckets of Stats.SendLatencyHistogram.
+func SendLatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), sendLatencyBuckets[:]...)
+}
+
+// clientStats holds the counters behind Stats. They are updated by processQueue and the
+// sending goroutines and can be read concurrently.
+type clientStats struct {
+	queued, sent, retried, requeued, dropped, failed atomic.Uint64
+	filtered, sampled, rateLimited                   atomic.Uint64
+	pending, inFlight                                atomic.Int64
+	bytesSent, sendCount                             atomic.Uint64
+	sendLatency                                      atomic.Int64 // Total nanoseconds over sendCount attempts
+	latencyHistogram                                 [len(sendLatencyBuckets) + 1]atomic.Uint64
+
+	mu            sync.Mutex
+	lastError     error
+	lastErrorTime time.Time
+	lastSuccess   time.Time
+}
+
+// Stats returns a snapshot of the client's delivery metrics. It is safe to call concurrently.
+func (c *Client) Stats() Stats {
+	s := &c.stats
+	snapshot := Stats{
+		Queued:     s.queued.Load(),
+		Sent:       s.sent.Load(),
+		Retried:    s.retried.Load(),
+		Requeued:   s.requeued.Load(),
+		Dropped:    s.dropped.Load(),
+		Failed:     s.failed.Load(),
+		Filtered:   s.filtered.Load(),
+		Sampled:    s.sampled.Load(),
+		Limited:    s.rateLimited.Load(),
+		QueueDepth: s.pending.Load(),
+		InFlight:   s.inFlight.Load(),
+		BytesSent:  s.bytesSent.Load(),
+
+		SendAttempts:         s.sendCount.Load(),
+		TotalSendLatency:     time.Duration(s.sendLatency.Load()),
+		SendLatencyHistogram: make([]uint64, len(s.latencyHistogram)),
+	}
+	if snapshot.SendAttempts > 0 {
+		snapshot.AverageSendLatency = snapshot.TotalSendLatency / time.Duration(snapshot.SendAttempts)
+	}
+	for i := range s.latencyHistogram {
+		snapshot.SendLatencyHistogram[i] = s.latencyHistogram[i].Load()
+	}
+	s.mu.Lock()
+	snapshot.LastError = s.lastError
+	snapshot.LastErrorTime = s.lastErrorTime
+	snapshot.LastSuccess = s.lastSuccess
+	s.mu.Unlock()
+	return snapshot
+}
+
+func (s *clientStats) recordQueued(n int) {
+	s.queued.Add(uint64(n))
+	s.pending.Add(int64(n))
+}
+
+func (s *clientStats) recordDropped(n int, pending bool) {
+	s.dropped.Add(uint64(n))
+	if pending {
+		s.pending.Add(-int64(n))
+	}
+}
+
+func (s *clientStats) recordSent(n int) {
+	s.sent.Add(uint64(n))
+	s.pending.Add(-int64(n))
+}
+
+func (s *clientStats) recordFiltered(n int) {
+	s.filtered.Add(uint64(n))
+	s.pending.Add(-int64(n))
+}
+
+func (s *clientStats) recordFailed(n int) {
+	s.failed.Add(uint64(n))
+	s.pending.Add(-int64(n))
+}
+
+// recordAttempt records the outcome of a single request to the transport.
+func (s *clientStats) recordAttempt(latency time.Duration, bytes int, err error) {
+	s.sendCount.Add(1)
+	s.sendLatency.Add(int64(latency))
+	bucket := len(sendLatencyBuckets)
+	for i, bound := range sendLatencyBuckets {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.latencyHistogram[bucket].Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err
+		s.lastErrorTime = time.Now()
+		return
+	}
+	s.bytesSent.Add(uint64(bytes))
+	s.lastSuccess = time.Now()
+}
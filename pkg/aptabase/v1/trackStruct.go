@@ -0,0 +1,124 @@
+package aptabase
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// EventNamer is implemented by structs passed to TrackStruct that name their own event.
+type EventNamer interface {
+	EventName() string
+}
+
+// structInfo is the reflection metadata TrackStruct needs for a struct type, computed once per type.
+type structInfo struct {
+	eventName string // From the tag of a blank field, empty if the type has none
+	fields    []structField
+}
+
+type structField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+}
+
+var structInfoCache sync.Map // reflect.Type -> *structInfo
+
+// TrackStruct tracks a struct, or a pointer to one, as an event. The event name comes from its
+// EventName method or else from the tag of a blank field:
+//
+//	type Checkout struct {
+//		_     struct{} `aptabase:"checkout_completed"`
+//		Plan  string   `aptabase:"plan"`
+//		Items int      `aptabase:"items,omitempty"`
+//		Notes string   `aptabase:"-"`
+//	}
+//
+// Exported fields become props named after their tag, or the field name without one.
+// Fields tagged "-" are skipped, those with omitempty are skipped when zero, and the fields of
+// embedded structs are promoted. Prop values are then checked like those given to TrackEvent.
+func (c *Client) TrackStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return fmt.Errorf("%w: TrackStruct called with a nil pointer", ErrInvalidEvent)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: TrackStruct needs a struct, got %T", ErrInvalidEvent, v)
+	}
+	info := cachedStructInfo(rv.Type())
+
+	name := info.eventName
+	if namer, ok := v.(EventNamer); ok {
+		name = namer.EventName()
+	}
+	if name == "" {
+		return fmt.Errorf("%w: %s has no EventName method or event name tag", ErrInvalidEvent, rv.Type())
+	}
+
+	props := make(map[string]interface{}, len(info.fields))
+	for _, field := range info.fields {
+		fv, err := rv.FieldByIndexErr(field.index)
+		if err != nil {
+			continue // Field of a nil embedded pointer
+		}
+		if field.omitEmpty && fv.IsZero() {
+			continue
+		}
+		props[field.name] = fv.Interface()
+	}
+	return c.TrackEvent(EventData{EventName: name, Props: props})
+}
+
+func cachedStructInfo(t reflect.Type) *structInfo {
+	if info, ok := structInfoCache.Load(t); ok {
+		return info.(*structInfo)
+	}
+	info := &structInfo{}
+	info.collect(t, nil)
+	cached, _ := structInfoCache.LoadOrStore(t, info)
+	return cached.(*structInfo)
+}
+
+// collect adds the props of struct type t, whose fields are found at the index path prefix.
+func (info *structInfo) collect(t reflect.Type, prefix []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("aptabase")
+		name, opts, hasOpts := strings.Cut(tag, ",")
+		if f.Name == "_" {
+			if info.eventName == "" && name != "" {
+				info.eventName = name
+			}
+			continue
+		}
+		if name == "-" && !hasOpts { // Like encoding/json, "-," names a prop "-"
+			continue
+		}
+
+		index := append(prefix[:len(prefix):len(prefix)], i)
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && !hasTag {
+			info.collect(ft, index)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		field := structField{index: index, name: name}
+		for _, opt := range strings.Split(opts, ",") {
+			field.omitEmpty = field.omitEmpty || opt == "omitempty"
+		}
+		info.fields = append(info.fields, field)
+	}
+}
@@ -0,0 +1,150 @@
+package aptabase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// captureTransport records the events it is given.
+type captureTransport struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (t *captureTransport) Send(_ context.Context, events []Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, events...)
+	return nil
+}
+
+type Base struct {
+	Plan string `aptabase:"plan"`
+}
+
+type Device struct {
+	OS string `aptabase:"os"`
+}
+
+type checkout struct {
+	_       struct{} `aptabase:"checkout_completed"`
+	Base             // Promoted
+	*Device          // Promoted when not nil
+	Items   int      `aptabase:"items,omitempty"`
+	Coupon  string   `aptabase:"coupon,omitempty"`
+	Notes   string   `aptabase:"-"`
+	Dash    string   `aptabase:"-,"`
+	Total   float64
+	secret  string
+}
+
+type namedEvent struct {
+	_    struct{} `aptabase:"from_tag"`
+	Step int      `aptabase:"step"`
+}
+
+func (namedEvent) EventName() string { return "from_method" }
+
+type pointerNamed struct {
+	Step int `aptabase:"step"`
+}
+
+func (*pointerNamed) EventName() string { return "from_pointer_method" }
+
+type taggedEmbed struct {
+	_    struct{} `aptabase:"tagged_embed"`
+	Base `aptabase:"base"`
+}
+
+type unnamed struct {
+	Step int
+}
+
+func TestTrackStruct(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     any
+		eventName string
+		props     map[string]interface{}
+		err       error
+	}{
+		{"tags", checkout{Base: Base{Plan: "pro"}, Items: 2, Notes: "n", Dash: "d", Total: 9.5, secret: "s"},
+			"checkout_completed", map[string]interface{}{"plan": "pro", "items": float64(2), "-": "d", "Total": 9.5}, nil},
+		{"omitempty kept when set", checkout{Coupon: "SPRING"},
+			"checkout_completed", map[string]interface{}{"plan": "", "coupon": "SPRING", "-": "", "Total": float64(0)}, nil},
+		{"pointer embedded", &checkout{Device: &Device{OS: "linux"}},
+			"checkout_completed", map[string]interface{}{"plan": "", "os": "linux", "-": "", "Total": float64(0)}, nil},
+		{"pointer to pointer", func() any { c := &checkout{}; return &c }(),
+			"checkout_completed", map[string]interface{}{"plan": "", "-": "", "Total": float64(0)}, nil},
+		{"EventNamer wins over the tag", namedEvent{Step: 1}, "from_method", map[string]interface{}{"step": float64(1)}, nil},
+		{"EventNamer on pointer", &pointerNamed{Step: 2}, "from_pointer_method", map[string]interface{}{"step": float64(2)}, nil},
+		{"EventNamer on pointer given a value", pointerNamed{Step: 2}, "", nil, ErrInvalidEvent},
+		{"tagged embedded struct is a prop", taggedEmbed{}, "", nil, ErrInvalidProp},
+		{"no event name", unnamed{}, "", nil, ErrInvalidEvent},
+		{"nil pointer", (*checkout)(nil), "", nil, ErrInvalidEvent},
+		{"not a struct", map[string]interface{}{"a": 1}, "", nil, ErrInvalidEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &captureTransport{}
+			client, err := New("A-US-1234567890", WithTransport(transport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.TrackStruct(tt.value)
+			client.Stop()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("TrackStruct = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				if len(transport.events) != 0 {
+					t.Errorf("sent %d events, want none", len(transport.events))
+				}
+				return
+			}
+			if len(transport.events) != 1 {
+				t.Fatalf("sent %d events, want 1", len(transport.events))
+			}
+			got := transport.events[0]
+			if got.EventName != tt.eventName {
+				t.Errorf("EventName = %q, want %q", got.EventName, tt.eventName)
+			}
+			props := make(map[string]interface{}, len(got.Props))
+			for k, v := range got.Props {
+				if n, ok := v.(int); ok {
+					v = float64(n) // Compare numbers whatever their Go type
+				}
+				props[k] = v
+			}
+			if !reflect.DeepEqual(props, tt.props) {
+				t.Errorf("props = %#v, want %#v", props, tt.props)
+			}
+		})
+	}
+}
+
+func TestStructInfoCache(t *testing.T) {
+	typ := reflect.TypeOf(checkout{})
+	first := cachedStructInfo(typ)
+	if second := cachedStructInfo(typ); second != first {
+		t.Error("struct info computed again for the same type")
+	}
+	if other := cachedStructInfo(reflect.TypeOf(namedEvent{})); other == first {
+		t.Error("struct info shared by different types")
+	}
+
+	want := []structField{
+		{index: []int{1, 0}, name: "plan"},
+		{index: []int{2, 0}, name: "os"},
+		{index: []int{3}, name: "items", omitEmpty: true},
+		{index: []int{4}, name: "coupon", omitEmpty: true},
+		{index: []int{6}, name: "-"},
+		{index: []int{7}, name: "Total"},
+	}
+	if first.eventName != "checkout_completed" || !reflect.DeepEqual(first.fields, want) {
+		t.Errorf("struct info = %q %+v, want %q %+v", first.eventName, first.fields, "checkout_completed", want)
+	}
+}
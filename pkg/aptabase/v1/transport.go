@@ -0,0 +1,110 @@
+package aptabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event is a single event in the form it is delivered to a Transport.
+type Event struct {
+	Timestamp   time.Time              `json:"timestamp"`
+	SessionID   string                 `json:"sessionId"`
+	EventName   string                 `json:"eventName"`
+	SystemProps map[string]interface{} `json:"systemProps"`
+	Props       map[string]interface{} `json:"props"`
+}
+
+// Transport delivers batches of events. Implementations must be safe for concurrent use.
+//
+// Errors are retried according to the client's RetryPolicy unless IsRetryable reports false,
+// so a Transport should wrap errors that cannot be fixed by retrying with Permanent.
+type Transport interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// Permanent wraps err so the client drops the batch instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// WriterTransport writes every event as a line of JSON, e.g. to a file or os.Stdout.
+type WriterTransport struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterTransport creates a WriterTransport writing to w.
+func NewWriterTransport(w io.Writer) *WriterTransport {
+	return &WriterTransport{w: w}
+}
+
+// Send writes the events to the underlying writer.
+func (t *WriterTransport) Send(ctx context.Context, events []Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	encoder := json.NewEncoder(t.w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryTransport records events in memory instead of sending them, which is handy in tests.
+type MemoryTransport struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Send records the events.
+func (t *MemoryTransport) Send(ctx context.Context, events []Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, events...)
+	return nil
+}
+
+// Events returns a copy of every event recorded so far.
+func (t *MemoryTransport) Events() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// Reset forgets the recorded events.
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = nil
+}
+
+type multiTransport []Transport
+
+// MultiTransport fans every batch out to all transports concurrently.
+// If any of them fails transiently the batch is retried on all of them, so backends may see duplicates.
+// It is only dropped once every failure left is permanent.
+func MultiTransport(transports ...Transport) Transport {
+	return multiTransport(transports)
+}
+
+func (m multiTransport) Send(ctx context.Context, events []Event) error {
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+	for i, transport := range m {
+		wg.Add(1)
+		go func(i int, transport Transport) {
+			defer wg.Done()
+			errs[i] = transport.Send(ctx, events)
+		}(i, transport)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -7,7 +7,6 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -33,7 +32,6 @@ func getMacDeviceModel() (string, error) {
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		log.Printf("Error running sysctl: %v", err)
 		return "", err
 	}
 
@@ -59,7 +57,6 @@ func getFreeBSDDeviceModel() (string, error) {
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		log.Printf("Error running kenv: %v", err)
 		return "", err
 	}
 
@@ -0,0 +1,24 @@
+module github.com/brycensranch/go-aptabase/pkg/metrics
+
+go 1.22.0
+
+require (
+	github.com/brycensranch/go-aptabase/pkg v0.0.0-20241214123839-ab671bb8d786
+	github.com/prometheus/client_golang v1.20.5
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/exp v0.0.0-20240909161429-701f63a606c0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
+
+// Kept in its own module so the SDK itself has no external dependencies. The replace only applies
+// when working in this repository; bump the require above when releasing pkg.
+replace github.com/brycensranch/go-aptabase/pkg => ../
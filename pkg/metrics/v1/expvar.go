@@ -0,0 +1,106 @@
+// Package metrics publishes the delivery metrics of Aptabase clients, see aptabase.Client.Stats,
+// as expvar variables and as a Prometheus collector. Clients are keyed by their region and a short hash
+// of their App Key, e.g. "A-EU-#b643c9de", so several clients can be published side by side without
+// exposing the key.
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+)
+
+// ExpvarName is the name of the expvar map holding one entry per published client.
+const ExpvarName = "aptabase"
+
+var (
+	expvarOnce sync.Once
+	expvarMap  *expvar.Map
+)
+
+// clientLabel returns the key a client is published under. Unlike the redacted App Key, which only
+// keeps the last digits, the hash tells keys apart, while 32 bits are too few to recover the key.
+func clientLabel(client *aptabase.Client) string {
+	key := client.AppKey()
+	sum := sha256.Sum256([]byte(key.String()))
+	return key.Prefix + "-" + key.Region + "-#" + hex.EncodeToString(sum[:4])
+}
+
+// expvarStats is the JSON form of aptabase.Stats published under /debug/vars.
+type expvarStats struct {
+	Queued               uint64   `json:"queued"`
+	Sent                 uint64   `json:"sent"`
+	Retried              uint64   `json:"retried"`
+	Requeued             uint64   `json:"requeued"`
+	Dropped              uint64   `json:"dropped"`
+	Failed               uint64   `json:"failed"`
+	Filtered             uint64   `json:"filtered"`
+	Sampled              uint64   `json:"sampled"`
+	Limited              uint64   `json:"limited"`
+	QueueDepth           int64    `json:"queueDepth"`
+	InFlight             int64    `json:"inFlight"`
+	BytesSent            uint64   `json:"bytesSent"`
+	SendAttempts         uint64   `json:"sendAttempts"`
+	AverageSendLatencyMs float64  `json:"averageSendLatencyMs"`
+	SendLatencyBucketsMs []int64  `json:"sendLatencyBucketsMs"`
+	SendLatencyHistogram []uint64 `json:"sendLatencyHistogram"`
+	LastError            string   `json:"lastError,omitempty"`
+	LastErrorTime        string   `json:"lastErrorTime,omitempty"`
+	LastSuccess          string   `json:"lastSuccess,omitempty"`
+}
+
+// PublishExpvar publishes the client's metrics in the "aptabase" expvar map, under its hashed App Key.
+// The values are read from Client.Stats whenever /debug/vars is served.
+// Publishing another client with the same App Key replaces the previous one.
+func PublishExpvar(client *aptabase.Client) {
+	expvarOnce.Do(func() {
+		expvarMap = expvar.NewMap(ExpvarName)
+	})
+	expvarMap.Set(clientLabel(client), expvar.Func(func() any {
+		return newExpvarStats(client.Stats())
+	}))
+}
+
+// UnpublishExpvar removes the client's entry from the "aptabase" expvar map.
+func UnpublishExpvar(client *aptabase.Client) {
+	if expvarMap != nil {
+		expvarMap.Delete(clientLabel(client))
+	}
+}
+
+func newExpvarStats(stats aptabase.Stats) expvarStats {
+	buckets := aptabase.SendLatencyBuckets()
+	v := expvarStats{
+		Queued:               stats.Queued,
+		Sent:                 stats.Sent,
+		Retried:              stats.Retried,
+		Requeued:             stats.Requeued,
+		Dropped:              stats.Dropped,
+		Failed:               stats.Failed,
+		Filtered:             stats.Filtered,
+		Sampled:              stats.Sampled,
+		Limited:              stats.Limited,
+		QueueDepth:           stats.QueueDepth,
+		InFlight:             stats.InFlight,
+		BytesSent:            stats.BytesSent,
+		SendAttempts:         stats.SendAttempts,
+		AverageSendLatencyMs: float64(stats.AverageSendLatency.Microseconds()) / 1000,
+		SendLatencyBucketsMs: make([]int64, len(buckets)),
+		SendLatencyHistogram: stats.SendLatencyHistogram,
+	}
+	for i, bound := range buckets {
+		v.SendLatencyBucketsMs[i] = bound.Milliseconds()
+	}
+	if stats.LastError != nil {
+		v.LastError = stats.LastError.Error()
+		v.LastErrorTime = stats.LastErrorTime.UTC().Format(time.RFC3339)
+	}
+	if !stats.LastSuccess.IsZero() {
+		v.LastSuccess = stats.LastSuccess.UTC().Format(time.RFC3339)
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/brycensranch/go-aptabase/pkg/aptabase/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queuedDesc     = newDesc("events_queued_total", "Events accepted by TrackEvent or replayed from the disk queue.")
+	sentDesc       = newDesc("events_sent_total", "Events accepted by Aptabase.")
+	requeuedDesc   = newDesc("events_requeued_total", "Events handed back to the queue after exhausting their retries.")
+	droppedDesc    = newDesc("events_dropped_total", "Events discarded for invalid props, without consent, by the overflow policy, by ForgetLocalData, beyond the backlog of unsent events or around Stop.")
+	failedDesc     = newDesc("events_failed_total", "Events Aptabase rejected permanently.")
+	filteredDesc   = newDesc("events_filtered_total", "Events dropped by a BeforeSend interceptor.")
+	sampledDesc    = newDesc("events_sampled_out_total", "Events left out by sampling.")
+	limitedDesc    = newDesc("events_rate_limited_total", "Events over a rate limit or quota.")
+	retriedDesc    = newDesc("requests_retried_total", "Send attempts that failed and were retried.")
+	bytesSentDesc  = newDesc("sent_bytes_total", "Payload bytes of successful requests.")
+	queueDepthDesc = newDesc("queue_depth", "Events tracked but not yet sent, failed or dropped.")
+	inFlightDesc   = newDesc("requests_in_flight", "Requests currently being sent.")
+	latencyDesc    = newDesc("send_latency_seconds", "Duration of a single send attempt.")
+)
+
+func newDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName("aptabase", "", name), help, []string{"app_key"}, nil)
+}
+
+// Collector is a prometheus.Collector exposing the metrics of one or more clients,
+// labelled with their hashed App Key, see the package documentation.
+type Collector struct {
+	mu      sync.RWMutex
+	clients map[string]*aptabase.Client
+}
+
+// NewCollector creates a Collector for the given clients. More can be added with Add.
+func NewCollector(clients ...*aptabase.Client) *Collector {
+	c := &Collector{clients: make(map[string]*aptabase.Client)}
+	for _, client := range clients {
+		c.Add(client)
+	}
+	return c
+}
+
+// Add starts exposing the client's metrics. A client with the same App Key is replaced.
+func (c *Collector) Add(client *aptabase.Client) {
+	c.mu.Lock()
+	c.clients[clientLabel(client)] = client
+	c.mu.Unlock()
+}
+
+// Remove stops exposing the client's metrics.
+func (c *Collector) Remove(client *aptabase.Client) {
+	c.mu.Lock()
+	delete(c.clients, clientLabel(client))
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		queuedDesc, sentDesc, requeuedDesc, droppedDesc, failedDesc, filteredDesc, sampledDesc, limitedDesc, retriedDesc,
+		bytesSentDesc, queueDepthDesc, inFlightDesc, latencyDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	buckets := aptabase.SendLatencyBuckets()
+	for appKey, client := range c.clients {
+		stats := client.Stats()
+		counter := func(desc *prometheus.Desc, value uint64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), appKey)
+		}
+		counter(queuedDesc, stats.Queued)
+		counter(sentDesc, stats.Sent)
+		counter(requeuedDesc, stats.Requeued)
+		counter(droppedDesc, stats.Dropped)
+		counter(failedDesc, stats.Failed)
+		counter(filteredDesc, stats.Filtered)
+		counter(sampledDesc, stats.Sampled)
+		counter(limitedDesc, stats.Limited)
+		counter(retriedDesc, stats.Retried)
+		counter(bytesSentDesc, stats.BytesSent)
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(stats.QueueDepth), appKey)
+		ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(stats.InFlight), appKey)
+
+		// Prometheus buckets are cumulative, the SDK's are not
+		cumulative := make(map[float64]uint64, len(buckets))
+		var count uint64
+		for i, bound := range buckets {
+			count += stats.SendLatencyHistogram[i]
+			cumulative[bound.Seconds()] = count
+		}
+		count += stats.SendLatencyHistogram[len(buckets)]
+		ch <- prometheus.MustNewConstHistogram(latencyDesc, count, stats.TotalSendLatency.Seconds(), cumulative, appKey)
+	}
+}
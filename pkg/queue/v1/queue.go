@@ -0,0 +1,633 @@
+// Package queue implements a durable, append-only record queue stored as segment files in a directory.
+//
+// Records are appended to the newest segment and stay on disk until they are acknowledged with Ack.
+// Acknowledgements go to a separate log, and segments whose records are all acknowledged are removed
+// by compaction, so nothing is deleted before the caller has confirmed delivery.
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentExt = ".seg"
+	acksName   = "acks.log"
+
+	// headerSize is the length (4) + CRC32 (4) + ID (8) prefix written before every record.
+	headerSize = 16
+
+	defaultMaxSegmentBytes = 1 << 20
+	defaultMaxBytes        = 16 << 20
+	defaultSyncInterval    = 1 * time.Second
+)
+
+// ErrClosed is returned when a Queue is used after Close.
+var ErrClosed = errors.New("queue: closed")
+
+// SyncPolicy controls how often appended records and acknowledgements are fsynced to disk.
+type SyncPolicy int
+
+const (
+	// SyncInterval fsyncs at most once per Options.SyncInterval, from a background goroutine when
+	// the queue is idle. It is the default. A power loss can lose the records of the last interval,
+	// a process crash cannot.
+	SyncInterval SyncPolicy = iota
+	// SyncAlways fsyncs after every Append and Ack. It is the safest and slowest policy.
+	SyncAlways
+	// SyncNever leaves flushing to the operating system. Records survive a process crash but not a power loss.
+	SyncNever
+)
+
+// Options configures a Queue. The zero value is usable.
+type Options struct {
+	SyncPolicy      SyncPolicy
+	SyncInterval    time.Duration // Used by SyncInterval, defaults to 1 second
+	MaxSegmentBytes int64         // Size at which a new segment is started, defaults to 1 MiB
+	MaxBytes        int64         // Total size cap, the oldest segments are dropped beyond it. Defaults to 16 MiB
+}
+
+// Record is a single entry in the queue.
+type Record struct {
+	ID   uint64
+	Data []byte
+}
+
+type segment struct {
+	path    string
+	size    int64
+	ids     []uint64 // Record IDs in file order, always ascending
+	unacked int
+}
+
+// Queue is a durable FIFO of records. It is safe for concurrent use.
+// A directory must not be shared by two open queues.
+type Queue struct {
+	mu         sync.Mutex
+	dir        string
+	opts       Options
+	segments   []*segment // Oldest first, the last one is appended to
+	active     *os.File
+	acks       *os.File
+	acked      map[uint64]struct{}
+	nextID     uint64
+	totalBytes int64
+	lastSync   time.Time
+	unsynced   bool // Writes since the last sync, used by SyncInterval
+	dropped    uint64
+	closed     bool
+	done       chan struct{} // Closed by Close to stop syncLoop
+}
+
+// Open opens the queue stored in dir, creating the directory if needed.
+// Records left over from a previous run are available through Pending.
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if opts.MaxSegmentBytes <= 0 {
+		opts.MaxSegmentBytes = defaultMaxSegmentBytes
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("queue: creating %s: %w", dir, err)
+	}
+
+	q := &Queue{
+		dir:      dir,
+		opts:     opts,
+		acked:    make(map[uint64]struct{}),
+		nextID:   1,
+		lastSync: time.Now(),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.compactLocked(); err != nil {
+		return nil, err
+	}
+	if opts.SyncPolicy == SyncInterval {
+		q.done = make(chan struct{})
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// syncLoop syncs the writes SyncInterval left unsynced every interval, so records written
+// right before the queue goes idle do not wait for the next Append, Ack or Close.
+func (q *Queue) syncLoop() {
+	ticker := time.NewTicker(q.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.unsynced && !q.closed {
+				// An error is returned by the next Append, Ack or Close, which sync again
+				_ = q.syncLocked()
+			}
+			q.mu.Unlock()
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// load reads every segment and the acknowledgement log, truncating torn writes left by a crash.
+func (q *Queue) load() error {
+	paths, err := filepath.Glob(filepath.Join(q.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		seg := &segment{path: path}
+		err := scanSegment(path, func(rec Record) {
+			seg.ids = append(seg.ids, rec.ID)
+			if rec.ID >= q.nextID {
+				q.nextID = rec.ID + 1
+			}
+		}, &seg.size)
+		if err != nil {
+			return err
+		}
+		seg.unacked = len(seg.ids)
+		q.segments = append(q.segments, seg)
+		q.totalBytes += seg.size
+	}
+
+	data, err := os.ReadFile(filepath.Join(q.dir, acksName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("queue: reading acks: %w", err)
+	}
+	acked := make(map[uint64]struct{}, len(data)/8)
+	for len(data) >= 8 {
+		acked[binary.LittleEndian.Uint64(data)] = struct{}{}
+		data = data[8:]
+	}
+	for _, seg := range q.segments {
+		for _, id := range seg.ids {
+			if _, ok := acked[id]; ok {
+				q.acked[id] = struct{}{}
+				seg.unacked--
+			}
+		}
+	}
+	return nil
+}
+
+// Append writes a record to the queue and returns its ID.
+func (q *Queue) Append(data []byte) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+
+	seg, err := q.activeSegment()
+	if err != nil {
+		return 0, err
+	}
+
+	id := q.nextID
+	buf := encodeRecord(id, data)
+	if _, err := q.active.Write(buf); err != nil {
+		return 0, fmt.Errorf("queue: appending to %s: %w", seg.path, err)
+	}
+	q.nextID++
+	seg.ids = append(seg.ids, id)
+	seg.unacked++
+	seg.size += int64(len(buf))
+	q.totalBytes += int64(len(buf))
+
+	if err := q.maybeSync(q.active); err != nil {
+		return id, err
+	}
+	return id, q.enforceMaxBytes()
+}
+
+// activeSegment returns the segment to append to, starting a new one when the current one is full.
+func (q *Queue) activeSegment() (*segment, error) {
+	if n := len(q.segments); n > 0 {
+		seg := q.segments[n-1]
+		if seg.size < q.opts.MaxSegmentBytes {
+			if q.active == nil {
+				f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0o600)
+				if err != nil {
+					return nil, fmt.Errorf("queue: opening %s: %w", seg.path, err)
+				}
+				q.active = f
+			}
+			return seg, nil
+		}
+	}
+
+	if err := q.closeActive(); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(q.dir, fmt.Sprintf("%020d%s", q.nextID, segmentExt))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("queue: creating %s: %w", path, err)
+	}
+	q.active = f
+	seg := &segment{path: path}
+	q.segments = append(q.segments, seg)
+	return seg, nil
+}
+
+// enforceMaxBytes drops the oldest segments, acknowledged or not, until the queue fits in MaxBytes.
+func (q *Queue) enforceMaxBytes() error {
+	for q.totalBytes > q.opts.MaxBytes && len(q.segments) > 1 {
+		seg := q.segments[0]
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("queue: dropping %s: %w", seg.path, err)
+		}
+		for _, id := range seg.ids {
+			delete(q.acked, id)
+		}
+		q.dropped += uint64(seg.unacked)
+		q.totalBytes -= seg.size
+		q.segments = q.segments[1:]
+	}
+	return nil
+}
+
+// Pending returns every record that has not been acknowledged yet, oldest first.
+func (q *Queue) Pending() ([]Record, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	var records []Record
+	for _, seg := range q.segments {
+		if seg.unacked == 0 {
+			continue
+		}
+		err := scanSegment(seg.path, func(rec Record) {
+			if _, ok := q.acked[rec.ID]; !ok {
+				records = append(records, rec)
+			}
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Ack marks records as delivered. Segments left without pending records are compacted away.
+// Unknown or already acknowledged IDs are ignored.
+func (q *Queue) Ack(ids ...uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	buf := make([]byte, 0, 8*len(ids))
+	emptied := false
+	for _, id := range ids {
+		if _, ok := q.acked[id]; ok {
+			continue
+		}
+		seg := q.segmentFor(id)
+		if seg == nil {
+			continue
+		}
+		q.acked[id] = struct{}{}
+		seg.unacked--
+		emptied = emptied || seg.unacked == 0
+		buf = binary.LittleEndian.AppendUint64(buf, id)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if q.acks == nil {
+		f, err := os.OpenFile(filepath.Join(q.dir, acksName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("queue: opening acks: %w", err)
+		}
+		q.acks = f
+	}
+	if _, err := q.acks.Write(buf); err != nil {
+		return fmt.Errorf("queue: writing acks: %w", err)
+	}
+	if err := q.maybeSync(q.acks); err != nil {
+		return err
+	}
+	if emptied {
+		return q.compactLocked()
+	}
+	return nil
+}
+
+// segmentFor returns the segment holding id, or nil if it is not in the queue.
+func (q *Queue) segmentFor(id uint64) *segment {
+	i := sort.Search(len(q.segments), func(i int) bool {
+		ids := q.segments[i].ids
+		return len(ids) > 0 && ids[len(ids)-1] >= id
+	})
+	if i == len(q.segments) {
+		return nil
+	}
+	seg := q.segments[i]
+	j := sort.Search(len(seg.ids), func(j int) bool { return seg.ids[j] >= id })
+	if j == len(seg.ids) || seg.ids[j] != id {
+		return nil
+	}
+	return seg
+}
+
+// Compact removes fully acknowledged segments, rewrites older segments that are mostly acknowledged
+// and trims the acknowledgement log to the records still on disk.
+func (q *Queue) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.compactLocked()
+}
+
+func (q *Queue) compactLocked() error {
+	kept := q.segments[:0]
+	for i, seg := range q.segments {
+		last := i == len(q.segments)-1
+		switch {
+		case len(seg.ids) == 0 && !last, len(seg.ids) > 0 && seg.unacked == 0:
+			if last {
+				if err := q.closeActive(); err != nil {
+					return err
+				}
+			}
+			if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("queue: removing %s: %w", seg.path, err)
+			}
+			for _, id := range seg.ids {
+				delete(q.acked, id)
+			}
+			q.totalBytes -= seg.size
+			continue
+		case !last && seg.unacked*2 < len(seg.ids):
+			if err := q.rewriteSegment(seg); err != nil {
+				return err
+			}
+		}
+		kept = append(kept, seg)
+	}
+	q.segments = kept
+	return q.rewriteAcks()
+}
+
+// rewriteSegment replaces a sealed segment with a copy holding only its unacknowledged records.
+func (q *Queue) rewriteSegment(seg *segment) error {
+	var buf []byte
+	var ids []uint64
+	err := scanSegment(seg.path, func(rec Record) {
+		if _, ok := q.acked[rec.ID]; ok {
+			return
+		}
+		ids = append(ids, rec.ID)
+		buf = append(buf, encodeRecord(rec.ID, rec.Data)...)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(seg.path, buf); err != nil {
+		return err
+	}
+	for _, id := range seg.ids {
+		delete(q.acked, id)
+	}
+	q.totalBytes += int64(len(buf)) - seg.size
+	seg.ids, seg.size, seg.unacked = ids, int64(len(buf)), len(ids)
+	return nil
+}
+
+// rewriteAcks replaces the acknowledgement log with the acknowledgements that are still relevant.
+func (q *Queue) rewriteAcks() error {
+	if q.acks != nil {
+		if err := q.acks.Close(); err != nil {
+			return fmt.Errorf("queue: closing acks: %w", err)
+		}
+		q.acks = nil
+	}
+	path := filepath.Join(q.dir, acksName)
+	if len(q.acked) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("queue: removing acks: %w", err)
+		}
+		return nil
+	}
+
+	ids := make([]uint64, 0, len(q.acked))
+	for id := range q.acked {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	buf := make([]byte, 0, 8*len(ids))
+	for _, id := range ids {
+		buf = binary.LittleEndian.AppendUint64(buf, id)
+	}
+	return writeFileAtomic(path, buf)
+}
+
+// Reset discards every record, acknowledged or not, and removes the queue's files.
+// IDs keep increasing, so acknowledging a record from before the reset is a no-op.
+func (q *Queue) Reset() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if err := q.closeActive(); err != nil {
+		return err
+	}
+	for _, seg := range q.segments {
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("queue: removing %s: %w", seg.path, err)
+		}
+	}
+	q.segments = nil
+	q.acked = make(map[uint64]struct{})
+	q.totalBytes = 0
+	return q.rewriteAcks()
+}
+
+// Len returns the number of records that have not been acknowledged.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, seg := range q.segments {
+		n += seg.unacked
+	}
+	return n
+}
+
+// Dropped returns how many unacknowledged records were discarded to respect MaxBytes.
+func (q *Queue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Sync flushes pending writes to stable storage regardless of the SyncPolicy.
+func (q *Queue) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.syncLocked()
+}
+
+func (q *Queue) syncLocked() error {
+	for _, f := range []*os.File{q.active, q.acks} {
+		if f == nil {
+			continue
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("queue: syncing %s: %w", f.Name(), err)
+		}
+	}
+	q.lastSync = time.Now()
+	q.unsynced = false
+	return nil
+}
+
+// maybeSync fsyncs f if the SyncPolicy asks for it.
+func (q *Queue) maybeSync(f *os.File) error {
+	switch q.opts.SyncPolicy {
+	case SyncAlways:
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("queue: syncing %s: %w", f.Name(), err)
+		}
+	case SyncInterval:
+		q.unsynced = true
+		if time.Since(q.lastSync) >= q.opts.SyncInterval {
+			return q.syncLocked()
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the queue. Pending records are kept for the next Open.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if q.done != nil {
+		close(q.done)
+	}
+	err := q.syncLocked()
+	if cerr := q.closeActive(); err == nil {
+		err = cerr
+	}
+	if q.acks != nil {
+		if cerr := q.acks.Close(); err == nil {
+			err = cerr
+		}
+		q.acks = nil
+	}
+	return err
+}
+
+func (q *Queue) closeActive() error {
+	if q.active == nil {
+		return nil
+	}
+	err := q.active.Close()
+	q.active = nil
+	if err != nil {
+		return fmt.Errorf("queue: closing segment: %w", err)
+	}
+	return nil
+}
+
+// encodeRecord frames data with its length, checksum and ID.
+func encodeRecord(id uint64, data []byte) []byte {
+	buf := make([]byte, headerSize+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint64(buf[8:16], id)
+	copy(buf[headerSize:], data)
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+	return buf
+}
+
+// scanSegment calls fn for every intact record in the segment at path.
+// If validSize is not nil, a torn or corrupt tail is truncated and the remaining size is stored in it.
+func scanSegment(path string, fn func(Record), validSize *int64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("queue: reading %s: %w", path, err)
+	}
+
+	offset := 0
+	for len(data)-offset >= headerSize {
+		length := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		end := offset + headerSize + length
+		if end > len(data) {
+			break
+		}
+		if crc32.ChecksumIEEE(data[offset+8:end]) != binary.LittleEndian.Uint32(data[offset+4:offset+8]) {
+			break
+		}
+		id := binary.LittleEndian.Uint64(data[offset+8 : offset+16])
+		fn(Record{ID: id, Data: data[offset+headerSize : end]})
+		offset = end
+	}
+
+	if validSize != nil {
+		*validSize = int64(offset)
+		if offset != len(data) {
+			if err := os.Truncate(path, int64(offset)); err != nil {
+				return fmt.Errorf("queue: truncating torn write in %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file and a rename.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("queue: rewriting %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("queue: rewriting %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("queue: rewriting %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("queue: rewriting %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("queue: rewriting %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordBytes is the size on disk of a record appended by appendN.
+const recordBytes = headerSize + 8
+
+func openQueue(t *testing.T, dir string, opts Options) *Queue {
+	t.Helper()
+	q, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// appendN appends n records of recordBytes each and returns their IDs.
+func appendN(t *testing.T, q *Queue, n int) []uint64 {
+	t.Helper()
+	ids := make([]uint64, n)
+	for i := range ids {
+		id, err := q.Append([]byte(fmt.Sprintf("rec%05d", i)))
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func pendingIDs(t *testing.T, q *Queue) []uint64 {
+	t.Helper()
+	records, err := q.Pending()
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	ids := []uint64{}
+	for _, rec := range records {
+		ids = append(ids, rec.ID)
+	}
+	return ids
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestAppendAckPending(t *testing.T) {
+	tests := []struct {
+		name    string
+		appends int
+		acks    []uint64
+		want    []uint64
+	}{
+		{"empty", 0, nil, []uint64{}},
+		{"nothing acked", 3, nil, []uint64{1, 2, 3}},
+		{"first acked", 3, []uint64{1}, []uint64{2, 3}},
+		{"middle acked", 3, []uint64{2}, []uint64{1, 3}},
+		{"all acked", 3, []uint64{3, 1, 2}, []uint64{}},
+		{"acked twice", 3, []uint64{2, 2}, []uint64{1, 3}},
+		{"unknown ids", 2, []uint64{0, 7}, []uint64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := openQueue(t, t.TempDir(), Options{})
+			appendN(t, q, tt.appends)
+			if err := q.Ack(tt.acks...); err != nil {
+				t.Fatalf("Ack: %v", err)
+			}
+			if got := pendingIDs(t, q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pending = %v, want %v", got, tt.want)
+			}
+			if got := q.Len(); got != len(tt.want) {
+				t.Errorf("Len = %d, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPendingData(t *testing.T) {
+	q := openQueue(t, t.TempDir(), Options{})
+	for _, data := range []string{"a", "", "ccc"} {
+		if _, err := q.Append([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := q.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, string(rec.Data))
+	}
+	if want := []string{"a", "", "ccc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending data = %q, want %q", got, want)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		acks     []uint64
+		segments int
+		pending  []uint64
+	}{
+		{"nothing acked", nil, 3, []uint64{1, 2, 3, 4, 5, 6}},
+		{"first segment acked", []uint64{1, 2}, 2, []uint64{3, 4, 5, 6}},
+		{"sealed segment mostly acked", []uint64{1, 3, 4}, 2, []uint64{2, 5, 6}},
+		{"everything acked", []uint64{1, 2, 3, 4, 5, 6}, 0, []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := openQueue(t, dir, Options{MaxSegmentBytes: 2 * recordBytes})
+			appendN(t, q, 6)
+			if err := q.Ack(tt.acks...); err != nil {
+				t.Fatalf("Ack: %v", err)
+			}
+			if err := q.Compact(); err != nil {
+				t.Fatalf("Compact: %v", err)
+			}
+			if got := len(segmentFiles(t, dir)); got != tt.segments {
+				t.Errorf("%d segment files, want %d", got, tt.segments)
+			}
+			if got := pendingIDs(t, q); !reflect.DeepEqual(got, tt.pending) {
+				t.Errorf("Pending = %v, want %v", got, tt.pending)
+			}
+			if len(tt.pending) == 0 {
+				if _, err := os.Stat(filepath.Join(dir, acksName)); !os.IsNotExist(err) {
+					t.Errorf("acks log kept after everything was acked: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestReopenAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{MaxSegmentBytes: 2 * recordBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close() // Only releases the files, after the test
+	appendN(t, q, 5)
+	if err := q.Ack(1, 4); err != nil {
+		t.Fatal(err)
+	}
+	// No Close: the process died with the files as they are.
+
+	reopened := openQueue(t, dir, Options{MaxSegmentBytes: 2 * recordBytes})
+	if got, want := pendingIDs(t, reopened), []uint64{2, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending after reopen = %v, want %v", got, want)
+	}
+	id, err := reopened.Append([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 6 {
+		t.Errorf("ID after reopen = %d, want 6", id)
+	}
+}
+
+func TestTornTrailingRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		tail func(last []byte) []byte
+	}{
+		{"partial header", func([]byte) []byte { return []byte{1, 2, 3} }},
+		{"partial payload", func(last []byte) []byte { return last[:len(last)-2] }},
+		{"bad checksum", func(last []byte) []byte {
+			corrupt := append([]byte(nil), last...)
+			corrupt[len(corrupt)-1] ^= 0xff
+			return corrupt
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := openQueue(t, dir, Options{})
+			appendN(t, q, 2)
+			if err := q.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			paths := segmentFiles(t, dir)
+			if len(paths) != 1 {
+				t.Fatalf("%d segment files, want 1", len(paths))
+			}
+			f, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(tt.tail(encodeRecord(3, []byte("torn")))); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			reopened := openQueue(t, dir, Options{})
+			if got, want := pendingIDs(t, reopened), []uint64{1, 2}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Pending = %v, want %v", got, want)
+			}
+			info, err := os.Stat(paths[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != 2*recordBytes {
+				t.Errorf("segment is %d bytes, want the torn record truncated to %d", info.Size(), 2*recordBytes)
+			}
+			if id, err := reopened.Append([]byte("next")); err != nil || id != 3 {
+				t.Errorf("Append = %d, %v, want 3", id, err)
+			}
+			if got, want := pendingIDs(t, reopened), []uint64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Pending after append = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		acks    []uint64
+		pending []uint64
+		dropped uint64
+	}{
+		{"unacked segments dropped", nil, []uint64{5, 6, 7, 8}, 4},
+		{"acked records not counted", []uint64{1, 2, 3}, []uint64{5, 6, 7, 8}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := openQueue(t, dir, Options{MaxSegmentBytes: 2 * recordBytes, MaxBytes: 4 * recordBytes})
+			appendN(t, q, 4)
+			if err := q.Ack(tt.acks...); err != nil {
+				t.Fatal(err)
+			}
+			appendN(t, q, 4)
+			if got := pendingIDs(t, q); !reflect.DeepEqual(got, tt.pending) {
+				t.Errorf("Pending = %v, want %v", got, tt.pending)
+			}
+			if got := q.Dropped(); got != tt.dropped {
+				t.Errorf("Dropped = %d, want %d", got, tt.dropped)
+			}
+			if got := len(segmentFiles(t, dir)); got != 2 {
+				t.Errorf("%d segment files, want 2", got)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, Options{MaxSegmentBytes: 2 * recordBytes})
+	ids := appendN(t, q, 5)
+	if err := q.Ack(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+
+	if got := pendingIDs(t, q); len(got) != 0 {
+		t.Errorf("Pending after Reset = %v, want none", got)
+	}
+	if got := q.Len(); got != 0 {
+		t.Errorf("Len after Reset = %d, want 0", got)
+	}
+	if got := segmentFiles(t, dir); len(got) != 0 {
+		t.Errorf("segment files left after Reset: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, acksName)); !os.IsNotExist(err) {
+		t.Errorf("acks log left after Reset: %v", err)
+	}
+
+	// Records from before the reset are gone for good, even when acked late.
+	if err := q.Ack(ids[1]); err != nil {
+		t.Fatalf("Ack of a reset record: %v", err)
+	}
+	id, err := q.Append([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id <= ids[len(ids)-1] {
+		t.Errorf("ID after Reset = %d, want more than %d", id, ids[len(ids)-1])
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openQueue(t, dir, Options{})
+	if got, want := pendingIDs(t, reopened), []uint64{id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending after reopen = %v, want %v", got, want)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	q := openQueue(t, t.TempDir(), Options{})
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Append(nil); err != ErrClosed {
+		t.Errorf("Append after Close = %v, want ErrClosed", err)
+	}
+	if err := q.Ack(1); err != ErrClosed {
+		t.Errorf("Ack after Close = %v, want ErrClosed", err)
+	}
+	if _, err := q.Pending(); err != ErrClosed {
+		t.Errorf("Pending after Close = %v, want ErrClosed", err)
+	}
+	if err := q.Reset(); err != ErrClosed {
+		t.Errorf("Reset after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestSyncIntervalWhenIdle(t *testing.T) {
+	q := openQueue(t, t.TempDir(), Options{SyncPolicy: SyncInterval, SyncInterval: 200 * time.Millisecond})
+	unsynced := func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.unsynced
+	}
+	appendN(t, q, 1)
+	if !unsynced() {
+		t.Fatal("Append synced before the interval passed")
+	}
+	time.Sleep(500 * time.Millisecond)
+	if unsynced() {
+		t.Error("records still unsynced after an idle interval")
+	}
+}